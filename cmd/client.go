@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strconv"
@@ -26,6 +27,8 @@ type clientContext struct {
 	opts         clientOpts      // options set by client
 	claims       *v4jwt.V4Claims // information about this user
 	ginCtx       *gin.Context    // gin context
+	ctx          context.Context // request context; cancelled when the client goes away or the request budget runs out
+	cancel       context.CancelFunc
 }
 
 func boolOptionWithFallback(opt string, fallback bool) bool {
@@ -40,6 +43,12 @@ func boolOptionWithFallback(opt string, fallback bool) bool {
 }
 
 func (c *clientContext) init(p *poolContext, ctx *gin.Context) {
+	c.initWithBudget(p, ctx, p.requestBudget)
+}
+
+func (c *clientContext) initWithBudget(p *poolContext, ctx *gin.Context, budget time.Duration) {
+	// as init(), but with a request budget other than the pool's; 0 means unlimited
+
 	c.ginCtx = ctx
 
 	c.start = time.Now()
@@ -49,9 +58,18 @@ func (c *clientContext) init(p *poolContext, ctx *gin.Context) {
 
 	// if there is no gin context, wrap up and return
 	if ctx == nil {
+		c.ctx, c.cancel = context.WithCancel(context.Background())
 		return
 	}
 
+	// bound the request context by the request budget, if any
+
+	if budget > 0 {
+		c.ctx, c.cancel = context.WithTimeout(ctx.Request.Context(), budget)
+	} else {
+		c.ctx, c.cancel = context.WithCancel(ctx.Request.Context())
+	}
+
 	// configure remaining items based on data in the gin context
 
 	c.reqID = fmt.Sprintf("%08x", p.randomSource.Uint32())
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// configuration problems are collected as they are found, rather than aborting at the first
+// one, so that a complete report can be produced (see -validate).  each problem is located by
+// its json path within the config, found by matching the address of the offending value
+// against the config tree.  values that are not part of the config (e.g. copies) are reported
+// against the closest config value that is.
+
+// matches the leading log tag of a problem message, e.g. "[VALIDATE] "
+var configProblemTagRegex = regexp.MustCompile(`^\[[A-Z]+\]\s*`)
+
+type configProblem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+type configReport struct {
+	File     string          `json:"file"`
+	Valid    bool            `json:"valid"`
+	Problems []configProblem `json:"problems"`
+}
+
+func (p *poolContext) configProblem(value interface{}, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	path := configPath(p.config, value)
+
+	problem := configProblem{Path: path, Message: configProblemTagRegex.ReplaceAllString(msg, "")}
+
+	// the same value may be checked more than once, e.g. for existence and then for a particular use
+	for _, existing := range p.problems {
+		if existing == problem {
+			return
+		}
+	}
+
+	if path != "" {
+		log.Printf("%s  (at %s)", msg, path)
+	} else {
+		log.Printf("%s", msg)
+	}
+
+	p.problems = append(p.problems, problem)
+}
+
+func configPath(cfg *poolConfig, value interface{}) string {
+	// returns the json path of the config value that the given pointer points to, if any
+
+	if cfg == nil || value == nil {
+		return ""
+	}
+
+	target := reflect.ValueOf(value)
+	if target.Kind() != reflect.Ptr || target.IsNil() == true {
+		return ""
+	}
+
+	path, _ := findConfigPath(reflect.ValueOf(cfg).Elem(), target.Pointer(), target.Type().Elem(), "")
+
+	return path
+}
+
+func findConfigPath(v reflect.Value, addr uintptr, typ reflect.Type, path string) (string, bool) {
+	if v.CanAddr() == true && v.Addr().Pointer() == addr && v.Type() == typ {
+		return path, true
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() == false {
+			return findConfigPath(v.Elem(), addr, typ, path)
+		}
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+
+			// unexported fields are derived at runtime, not configured
+			if field.IsExported() == false {
+				continue
+			}
+
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+
+			if name == "" {
+				name = field.Name
+			}
+
+			child := name
+			if path != "" {
+				child = path + "." + name
+			}
+
+			if found, ok := findConfigPath(v.Field(i), addr, typ, child); ok == true {
+				return found, true
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if found, ok := findConfigPath(v.Index(i), addr, typ, fmt.Sprintf("%s[%d]", path, i)); ok == true {
+				return found, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func decodeConfigForValidation(file string) (*poolConfig, []configProblem, error) {
+	// decodes as much of the config file as possible, noting any problems along the way.
+	// unknown fields and mismatched types are reported here, as the decoder silently ignores
+	// the former, and stops reporting after the first of the latter.
+
+	jsonBytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var raw interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(jsonBytes))
+	dec.UseNumber()
+
+	if err = dec.Decode(&raw); err != nil {
+		return nil, nil, err
+	}
+
+	problems := checkConfigJSON(raw, reflect.TypeOf(poolConfig{}), "")
+
+	// the rest of the config is still decoded around any mismatched types, which were reported above
+
+	var cfg poolConfig
+
+	if err = json.Unmarshal(jsonBytes, &cfg); err != nil {
+		var typeErr *json.UnmarshalTypeError
+
+		if errors.As(err, &typeErr) == false {
+			return nil, nil, err
+		}
+	}
+
+	return &cfg, problems, nil
+}
+
+func checkConfigJSON(raw interface{}, typ reflect.Type, path string) []configProblem {
+	// walks decoded json alongside the config type it decodes into, returning every unknown
+	// field and mismatched type, located by json path as in findConfigPath()
+
+	// null leaves any value at its default
+	if raw == nil {
+		return nil
+	}
+
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	mismatch := func(expected string) []configProblem {
+		return []configProblem{{Path: path, Message: fmt.Sprintf("expected %s, found json %s", expected, configJSONType(raw))}}
+	}
+
+	var problems []configProblem
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]interface{})
+		if ok == false {
+			return mismatch("object")
+		}
+
+		fields := make(map[string]reflect.StructField)
+
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+
+			// unexported fields are derived at runtime, not configured
+			if field.IsExported() == false {
+				continue
+			}
+
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+
+			if name == "" {
+				name = field.Name
+			}
+
+			fields[name] = field
+		}
+
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+
+			field, ok := fields[key]
+
+			// the decoder also matches field names case-insensitively
+			if ok == false {
+				for name := range fields {
+					if strings.EqualFold(name, key) == true {
+						field, ok = fields[name], true
+						break
+					}
+				}
+			}
+
+			if ok == false {
+				problems = append(problems, configProblem{Path: child, Message: "unknown field"})
+				continue
+			}
+
+			problems = append(problems, checkConfigJSON(obj[key], field.Type, child)...)
+		}
+
+	case reflect.Map:
+		obj, ok := raw.(map[string]interface{})
+		if ok == false {
+			return mismatch("object")
+		}
+
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			problems = append(problems, checkConfigJSON(obj[key], typ.Elem(), path+"."+key)...)
+		}
+
+	case reflect.Slice, reflect.Array:
+		arr, ok := raw.([]interface{})
+		if ok == false {
+			return mismatch("array")
+		}
+
+		for i := range arr {
+			problems = append(problems, checkConfigJSON(arr[i], typ.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+
+	case reflect.String:
+		if _, ok := raw.(string); ok == false {
+			return mismatch("string")
+		}
+
+	case reflect.Bool:
+		if _, ok := raw.(bool); ok == false {
+			return mismatch("boolean")
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		num, ok := raw.(json.Number)
+		if ok == false {
+			return mismatch("integer")
+		}
+
+		if _, err := strconv.ParseInt(num.String(), 10, 64); err != nil {
+			return mismatch("integer")
+		}
+
+	case reflect.Float32, reflect.Float64:
+		if _, ok := raw.(json.Number); ok == false {
+			return mismatch("number")
+		}
+	}
+
+	return problems
+}
+
+func configJSONType(raw interface{}) string {
+	switch raw.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	}
+
+	return "null"
+}
+
+func validateConfigFile(file string, schemaFile string) configReport {
+	report := configReport{File: file, Problems: []configProblem{}}
+
+	cfg, problems, err := decodeConfigForValidation(file)
+	if err != nil {
+		report.Problems = append(report.Problems, configProblem{Message: fmt.Sprintf("unable to load config: %s", err.Error())})
+		return report
+	}
+
+	report.Problems = append(report.Problems, problems...)
+
+	if schemaFile != "" {
+		cfg.Local.Solr.Schema.File = schemaFile
+	}
+
+	p := poolContext{validateOnly: true}
+
+	func() {
+		// a problem may leave later checks unable to run; report what was found up to that point
+		defer func() {
+			if r := recover(); r != nil {
+				p.problems = append(p.problems, configProblem{Message: fmt.Sprintf("validation stopped early: %v", r)})
+			}
+		}()
+
+		p.init(cfg)
+	}()
+
+	report.Problems = append(report.Problems, p.problems...)
+
+	report.Valid = len(report.Problems) == 0
+
+	return report
+}
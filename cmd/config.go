@@ -3,8 +3,12 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"regexp"
@@ -99,20 +103,50 @@ type poolConfigCopyright struct {
 	re         *regexp.Regexp
 }
 
+type poolConfigHTTPRetry struct {
+	MaxRetries string `json:"max_retries,omitempty"` // additional attempts for idempotent requests (default 0)
+	BaseDelay  string `json:"base_delay,omitempty"`  // initial backoff delay, in milliseconds
+	MaxDelay   string `json:"max_delay,omitempty"`   // maximum backoff delay, in milliseconds (default 2000)
+}
+
+type poolConfigHTTPCircuitBreaker struct {
+	FailureThreshold string `json:"failure_threshold,omitempty"` // consecutive failures before failing fast (default 0: disabled)
+	OpenTimeout      string `json:"open_timeout,omitempty"`      // seconds to fail fast before allowing a trial request
+}
+
 type poolConfigHTTPClient struct {
-	Enabled     bool   `json:"enabled"` // only used for serials solutions client
-	URL         string `json:"url,omitempty"`
-	Endpoint    string `json:"endpoint,omitempty"`
-	ConnTimeout string `json:"conn_timeout,omitempty"`
-	ReadTimeout string `json:"read_timeout,omitempty"`
+	Enabled        bool                         `json:"enabled"` // only used for serials solutions client
+	URL            string                       `json:"url,omitempty"`
+	Endpoint       string                       `json:"endpoint,omitempty"`
+	ConnTimeout    string                       `json:"conn_timeout,omitempty"`
+	ReadTimeout    string                       `json:"read_timeout,omitempty"`
+	Retry          poolConfigHTTPRetry          `json:"retry,omitempty"`           // only used for solr service client
+	CircuitBreaker poolConfigHTTPCircuitBreaker `json:"circuit_breaker,omitempty"` // only used for solr service client
+}
+
+type poolConfigFacetCache struct {
+	SnapshotDir        string `json:"snapshot_dir,omitempty"`         // directory for facet cache snapshots, loaded at startup (default: none)
+	MaxSnapshotAge     string `json:"max_snapshot_age,omitempty"`     // seconds; older snapshots are not loaded (default 0: no limit)
+	GlobalStartupDelay string `json:"global_startup_delay,omitempty"` // seconds before the first global cache refresh (default 0)
+	LocalStartupDelay  string `json:"local_startup_delay,omitempty"`  // seconds before the first local cache refresh (default 30)
+	RefreshInterval    string `json:"refresh_interval,omitempty"`     // seconds between cache refreshes (default 600, minimum 10)
+}
+
+type poolConfigExport struct {
+	MinimalRole string `json:"minimal_role,omitempty"` // least privileged v4jwt role allowed to export (default "staff")
+	MaxRecords  string `json:"max_records,omitempty"`  // most records streamed by a single export (default 100000)
 }
 
 type poolConfigService struct {
-	Port             string                 `json:"port,omitempty"`
-	JWTKey           string                 `json:"jwt_key,omitempty"`
-	DefaultSort      poolConfigSort         `json:"default_sort,omitempty"`
-	URLTemplates     poolConfigURLTemplates `json:"url_templates,omitempty"`
-	SerialsSolutions poolConfigHTTPClient   `json:"serials_solutions,omitempty"`
+	Port                string                 `json:"port,omitempty"`
+	JWTKey              string                 `json:"jwt_key,omitempty"`
+	DefaultSort         poolConfigSort         `json:"default_sort,omitempty"`
+	URLTemplates        poolConfigURLTemplates `json:"url_templates,omitempty"`
+	SerialsSolutions    poolConfigHTTPClient   `json:"serials_solutions,omitempty"`
+	RequestBudget       string                 `json:"request_budget,omitempty"`        // total time allowed per client request, in milliseconds (default 0: unlimited)
+	FilterGroupOperator string                 `json:"filter_group_operator,omitempty"` // combines multiple filter groups: "OR" (default) or "AND"
+	FacetCache          poolConfigFacetCache   `json:"facet_cache,omitempty"`
+	Export              poolConfigExport       `json:"export,omitempty"`
 }
 
 type poolConfigSolrParamsFq struct {
@@ -152,12 +186,53 @@ type poolConfigAuthorFields struct {
 	Fallback  []string `json:"fallback,omitempty"`
 }
 
+type poolConfigSolrReplicaCheck struct {
+	Interval    string `json:"interval,omitempty"`     // seconds between replica pings
+	MaxFailures string `json:"max_failures,omitempty"` // consecutive failed pings before a replica is taken out of rotation
+}
+
+type poolConfigSolrCache struct {
+	Size            string `json:"size,omitempty"`             // maximum number of cached responses (default 0: disabled)
+	VersionEndpoint string `json:"version_endpoint,omitempty"` // solr endpoint reporting the index version, e.g. luke or replication handler
+	VersionInterval string `json:"version_interval,omitempty"` // seconds between index version checks
+}
+
+type poolConfigSolrSchema struct {
+	Check    bool   `json:"check,omitempty"`    // verify configured fields against the live solr schema at startup
+	Endpoint string `json:"endpoint,omitempty"` // schema api endpoint (default "schema")
+	File     string `json:"file,omitempty"`     // saved schema api response to check against instead of live solr
+}
+
+type poolConfigSolrSpellcheck struct {
+	Enabled           bool     `json:"enabled,omitempty"`
+	Dictionary        string   `json:"dictionary,omitempty"`
+	Count             string   `json:"count,omitempty"`
+	MaxCollations     string   `json:"max_collations,omitempty"`
+	MaxCollationTries string   `json:"max_collation_tries,omitempty"`
+	MaxResults        int      `json:"max_results,omitempty"` // only offer suggestions when a search finds at most this many results
+	Fields            []string `json:"fields,omitempty"`      // v4 query fields eligible for spellchecking, e.g. keyword, title
+}
+
+type poolConfigSolrMoreLikeThis struct {
+	Fields        []string `json:"fields,omitempty"` // fields used to determine similarity
+	MinTermFreq   string   `json:"min_term_freq,omitempty"`
+	MinDocFreq    string   `json:"min_doc_freq,omitempty"`
+	MaxQueryTerms string   `json:"max_query_terms,omitempty"`
+	Rows          int      `json:"rows,omitempty"` // number of similar records returned
+}
+
 type poolConfigSolr struct {
 	Host                    string                     `json:"host,omitempty"`
+	Hosts                   []string                   `json:"hosts,omitempty"` // solr base urls of replicas; takes precedence over host
 	Core                    string                     `json:"core,omitempty"`
 	Clients                 poolConfigSolrClients      `json:"clients,omitempty"`
+	ReplicaCheck            poolConfigSolrReplicaCheck `json:"replica_check,omitempty"`
+	Cache                   poolConfigSolrCache        `json:"cache,omitempty"`
+	Schema                  poolConfigSolrSchema       `json:"schema,omitempty"`
 	Params                  poolConfigSolrParams       `json:"params,omitempty"`
 	Highlighting            poolConfigSolrHighlighting `json:"highlighting,omitempty"`
+	Spellcheck              poolConfigSolrSpellcheck   `json:"spellcheck,omitempty"`
+	MoreLikeThis            poolConfigSolrMoreLikeThis `json:"more_like_this,omitempty"`
 	IdentifierField         string                     `json:"identifier_field,omitempty"`
 	GroupField              string                     `json:"group_field,omitempty"`
 	RedirectField           string                     `json:"redirect_field,omitempty"`
@@ -279,18 +354,40 @@ type poolConfigFacetQuery struct {
 	Query string `json:"query,omitempty"`
 }
 
+type poolConfigFilterRange struct {
+	ValueType string   `json:"value_type,omitempty"` // "number" (default) or "date"
+	Start     string   `json:"start,omitempty"`      // with gap: buckets of a fixed size between start and end
+	End       string   `json:"end,omitempty"`
+	Gap       string   `json:"gap,omitempty"`    // a number, or for dates, a number of years (e.g. "+10YEARS")
+	Ranges    []string `json:"ranges,omitempty"` // or: a histogram of explicit ranges, in filter value syntax
+	solrStart string
+	solrEnd   string
+	solrGap   string
+	gapNumber float64
+	gapYears  int
+}
+
+type poolConfigFilterHierarchy struct {
+	ParentField string `json:"parent_field,omitempty"` // top level solr field; the filter's own solr field is the second level
+	ParentLimit int    `json:"parent_limit,omitempty"`
+	Separator   string `json:"separator,omitempty"` // joins parent and child values (default " > ")
+}
+
 type poolConfigFilter struct {
-	ID               string                 `json:"id,omitempty"`
-	Name             string                 `json:"name,omitempty"`
-	Solr             poolConfigFacetSolr    `json:"solr,omitempty"`
-	Type             string                 `json:"type,omitempty"`
-	Format           string                 `json:"format,omitempty"`
-	ExposedValues    []string               `json:"exposed_values,omitempty"`
-	ComponentQueries []poolConfigFacetQuery `json:"component_queries,omitempty"`
-	IsAvailability   bool                   `json:"is_availability,omitempty"`
-	BucketSort       string                 `json:"bucket_sort,omitempty"`
-	Hidden           bool                   `json:"hidden,omitempty"`
-	Index            int                    `json:"-"`
+	ID               string                    `json:"id,omitempty"`
+	Name             string                    `json:"name,omitempty"`
+	Solr             poolConfigFacetSolr       `json:"solr,omitempty"`
+	Type             string                    `json:"type,omitempty"`
+	Format           string                    `json:"format,omitempty"`
+	ExposedValues    []string                  `json:"exposed_values,omitempty"`
+	ComponentQueries []poolConfigFacetQuery    `json:"component_queries,omitempty"`
+	Range            poolConfigFilterRange     `json:"range,omitempty"`
+	Hierarchy        poolConfigFilterHierarchy `json:"hierarchy,omitempty"`
+	Match            string                    `json:"match,omitempty"` // how selected values combine: "any" (default) or "all"
+	IsAvailability   bool                      `json:"is_availability,omitempty"`
+	BucketSort       string                    `json:"bucket_sort,omitempty"`
+	Hidden           bool                      `json:"hidden,omitempty"`
+	Index            int                       `json:"-"`
 	queryMap         map[string]*poolConfigFacetQuery
 }
 
@@ -305,6 +402,10 @@ type poolConfigSort struct {
 	RecordOrder  string `json:"record_order,omitempty"`
 	GroupResults bool   `json:"group_results,omitempty"`
 	IsRelevance  bool   `json:"is_relevance,omitempty"`
+	// "expand": groups are populated from the initial search using solr's expand component.
+	// otherwise (or "queries"), group records and counts are retrieved with follow-up queries.
+	GroupStrategy    string `json:"group_strategy,omitempty"`
+	GroupRecordLimit int    `json:"group_record_limit,omitempty"` // maximum records per group for the "expand" strategy
 }
 
 type poolConfigIdentity struct {
@@ -394,6 +495,13 @@ type poolConfigFilterOverride struct {
 	DependentFilterIDs []string `json:"dependent_filter_ids,omitempty"`
 }
 
+type poolConfigSuggestion struct {
+	Field      string `json:"field,omitempty"`      // field name used by clients, e.g. "title"
+	Dictionary string `json:"dictionary,omitempty"` // solr field whose indexed terms are suggested
+	Lowercase  bool   `json:"lowercase,omitempty"`  // whether the dictionary field is lowercased at index time
+	Limit      int    `json:"limit,omitempty"`      // maximum number of suggestions returned
+}
+
 type poolConfigResourceTypeContext struct {
 	Value               string                              `json:"value,omitempty"`
 	Label               string                              `json:"label,omitempty"`
@@ -401,14 +509,17 @@ type poolConfigResourceTypeContext struct {
 	FieldNames          poolConfigMappingsConfiguredFields  `json:"field_names,omitempty"`
 	AdditionalFilterIDs []string                            `json:"additional_filter_ids,omitempty"`
 	FilterOverrides     map[string]poolConfigFilterOverride `json:"filter_overrides,omitempty"`
+	Suggestions         []poolConfigSuggestion              `json:"suggestions,omitempty"`
 	filters             []poolConfigFilter
 	filterMap           map[string]*poolConfigFilter
 	filterIDs           []string
+	facetIDs            map[string]bool // when set, the only filters returned as facets (see returnsFacet())
 	fields              resourceTypeFields
 }
 
 type poolConfigResourceTypes struct {
 	DefaultContext    string                          `json:"default_context,omitempty"`
+	CombinedFilters   string                          `json:"combined_filters,omitempty"` // facets when several resource types are selected: "union" (default) or "intersection"
 	SupportedContexts []string                        `json:"supported_contexts,omitempty"`
 	Contexts          []poolConfigResourceTypeContext `json:"contexts,omitempty"`
 }
@@ -455,7 +566,20 @@ func getSortedJSONEnvVars() []string {
 	return keys
 }
 
-func loadConfig() *poolConfig {
+func (cfg *poolConfig) hash() string {
+	// identifies this configuration, e.g. to detect data saved under a different one
+
+	bytes, err := json.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(bytes)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func loadConfig() (*poolConfig, error) {
 	cfg := poolConfig{}
 
 	// contents are either plain text json, or base64-encoded gzipped json
@@ -505,8 +629,7 @@ func loadConfig() *poolConfig {
 	}
 
 	if valid == false {
-		log.Printf("exiting due to json decode error(s) above")
-		os.Exit(1)
+		return nil, errors.New("json decode error(s) in config environment variables")
 	}
 
 	// optional convenience overrides to simplify terraform config
@@ -514,18 +637,40 @@ func loadConfig() *poolConfig {
 		cfg.Local.Solr.Host = host
 	}
 
+	if hosts := os.Getenv(envPrefix + "_SOLR_HOSTS"); hosts != "" {
+		cfg.Local.Solr.Hosts = strings.Split(hosts, ",")
+	}
+
 	if host := os.Getenv(envPrefix + "_DCON_HOST"); host != "" {
 		cfg.Global.Service.URLTemplates.DigitalContent.Host = host
 	}
 
+	if dir := os.Getenv(envPrefix + "_FACET_CACHE_DIR"); dir != "" {
+		cfg.Global.Service.FacetCache.SnapshotDir = dir
+	}
+
 	// log accumulated config
 	bytes, err := json.Marshal(cfg)
 	if err != nil {
-		log.Printf("error encoding config json: %s", err.Error())
-		os.Exit(1)
+		return nil, fmt.Errorf("error encoding config json: %s", err.Error())
 	}
 
 	log.Printf("[CONFIG] composite json:\n%s", string(bytes))
 
-	return &cfg
+	return &cfg, nil
+}
+
+func loadConfigFile(file string) (*poolConfig, error) {
+	jsonBytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg poolConfig
+
+	if err = json.Unmarshal(jsonBytes, &cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
 }
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/uvalib/virgo4-api/v4api"
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+// number of records retrieved from solr per cursor page
+const exportPageSize = 500
+
+const defaultExportMinimalRole = "staff"
+
+const defaultExportMaxRecords = 100000
+
+// exports that would exceed the record limit are refused before any records are sent.
+// once streaming has started, the outcome can only be reported in a trailer: "complete"
+// if every matching record was sent, otherwise "truncated" or "failed".
+const exportStatusTrailer = "X-Export-Status"
+
+const (
+	exportStatusComplete  = "complete"
+	exportStatusTruncated = "truncated"
+	exportStatusFailed    = "failed"
+)
+
+func (p *poolContext) exportMinimalRole() v4jwt.RoleEnum {
+	role := p.config.Global.Service.Export.MinimalRole
+	if role == "" {
+		role = defaultExportMinimalRole
+	}
+
+	return v4jwt.RoleFromString(role)
+}
+
+func (p *poolContext) exportMaxRecords() int {
+	if p.config.Global.Service.Export.MaxRecords == "" {
+		return defaultExportMaxRecords
+	}
+
+	return integerWithMinimum(p.config.Global.Service.Export.MaxRecords, 1)
+}
+
+func (s *searchContext) authorizeExport() searchResponse {
+	// exports are for staff: they can stream a large part of the index
+
+	if s.client.isAuthenticated() == false {
+		return searchResponse{status: http.StatusUnauthorized, err: errors.New("export requires an authenticated user")}
+	}
+
+	if minimalRole := s.pool.exportMinimalRole(); s.client.claims.Role < minimalRole {
+		return searchResponse{status: http.StatusForbidden, err: fmt.Errorf("export requires role %s or higher", minimalRole)}
+	}
+
+	return searchResponse{status: http.StatusOK}
+}
+
+func (s *searchContext) writeExportRecords(records []v4api.Record) error {
+	// records are streamed as newline-delimited json, one record per line
+
+	w := s.client.ginCtx.Writer
+
+	if w.Written() == false {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Trailer", exportStatusTrailer)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		line = append(line, '\n')
+
+		if _, err = w.Write(line); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+
+	return nil
+}
+
+func (s *searchContext) finishExport(status string, total int) {
+	// reports the outcome of an export whose records have started streaming
+
+	w := s.client.ginCtx.Writer
+
+	if w.Written() == false {
+		return
+	}
+
+	w.Header().Set(exportStatusTrailer, status)
+
+	s.log("EXPORT: %s after %d records", status, total)
+}
+
+func (s *searchContext) handleExportRequest() searchResponse {
+	s.virgo.endpoint = "export"
+
+	if resp := s.parseRequest(&s.virgo.req); resp.err != nil {
+		return resp
+	}
+
+	// every matching record, individually and in a stable order
+	s.virgo.flags.groupResults = false
+	s.virgo.flags.requestFacets = false
+	s.virgo.flags.includeSnippets = false
+
+	if err := s.validateSearchRequest(); err != nil {
+		return searchResponse{status: http.StatusBadRequest, err: err}
+	}
+
+	// nothing to export
+	if s.virgo.invalidFilters == true {
+		return searchResponse{status: http.StatusOK}
+	}
+
+	// page through results using a cursor; only one page is held in memory at a time
+
+	cursor := "*"
+	total := 0
+	maxRecords := s.pool.exportMaxRecords()
+
+	for total < maxRecords {
+		rows := exportPageSize
+		if maxRecords-total < rows {
+			rows = maxRecords - total
+		}
+
+		page := s.copySearchContext()
+
+		page.virgo.cursorMark = cursor
+		page.virgo.req.Pagination = v4api.Pagination{Start: 0, Rows: rows}
+
+		if resp := page.getPoolQueryResults(); resp.err != nil {
+			s.err("export stopped after %d records: %s", total, resp.err.Error())
+			s.finishExport(exportStatusFailed, total)
+			return resp
+		}
+
+		// refuse exports that cannot be completed, rather than sending a partial file
+		if total == 0 && page.virgo.poolRes.Pagination.Total > maxRecords {
+			return searchResponse{status: http.StatusRequestEntityTooLarge, err: fmt.Errorf("export of %d records exceeds the limit of %d; narrow the search", page.virgo.poolRes.Pagination.Total, maxRecords)}
+		}
+
+		var records []v4api.Record
+		if len(page.virgo.poolRes.Groups) > 0 {
+			records = page.virgo.poolRes.Groups[0].Records
+		}
+
+		if err := s.writeExportRecords(records); err != nil {
+			s.err("export stopped after %d records: %s", total, err.Error())
+			s.finishExport(exportStatusFailed, total)
+			return searchResponse{status: http.StatusInternalServerError, err: err}
+		}
+
+		total += len(records)
+
+		// solr signals the end of results by returning the same cursor
+		next := page.solr.res.NextCursorMark
+		if len(records) == 0 || next == "" || next == cursor || total >= page.virgo.poolRes.Pagination.Total {
+			s.finishExport(exportStatusComplete, total)
+			return searchResponse{status: http.StatusOK}
+		}
+
+		cursor = next
+	}
+
+	// the index grew past the limit during the export
+	s.warn("EXPORT: stopped at the limit of %d records", maxRecords)
+	s.finishExport(exportStatusTruncated, total)
+
+	return searchResponse{status: http.StatusOK}
+}
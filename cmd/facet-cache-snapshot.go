@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/uvalib/virgo4-api/v4api"
+)
+
+// facet cache snapshots: after each successful refresh, cached facets are saved to a local
+// file, which is loaded at startup so that cached facets are available immediately rather
+// than after the first refresh.  snapshots saved under a different configuration are ignored.
+
+type facetCacheSnapshotEntry struct {
+	ResourceType  string        `json:"resource_type,omitempty"`
+	Authenticated bool          `json:"authenticated"`
+	IndexVersion  string        `json:"index_version,omitempty"` // solr index version, if known
+	Created       time.Time     `json:"created"`
+	Facets        []v4api.Facet `json:"facets"`
+}
+
+type facetCacheSnapshot struct {
+	ConfigHash string                    `json:"config_hash"`
+	Entries    []facetCacheSnapshotEntry `json:"entries"`
+}
+
+func (f *facetCache) snapshotFile() string {
+	dir := f.searchCtx.pool.config.Global.Service.FacetCache.SnapshotDir
+	if dir == "" {
+		return ""
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("%s.json", f.searchCtx.client.reqID))
+}
+
+func (f *facetCache) saveSnapshot(entries map[facetCacheKey]*facetCacheEntry) error {
+	file := f.snapshotFile()
+	if file == "" {
+		return nil
+	}
+
+	snapshot := facetCacheSnapshot{ConfigHash: f.searchCtx.pool.configHash}
+
+	for key, entry := range entries {
+		// skip entries that have never been successfully refreshed
+		if entry.updated.IsZero() == true {
+			continue
+		}
+
+		e := facetCacheSnapshotEntry{
+			ResourceType:  key.resourceType,
+			Authenticated: key.authenticated,
+			IndexVersion:  entry.indexVersion,
+			Created:       entry.updated,
+			Facets:        entry.facets,
+		}
+
+		snapshot.Entries = append(snapshot.Entries, e)
+	}
+
+	bytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	// write to a uniquely named temporary file first, so that a partially written snapshot
+	// is never loaded, and concurrent saves (e.g. across a reload) cannot interleave
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(bytes); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+func (f *facetCache) loadSnapshot() (*facetCacheSnapshot, error) {
+	file := f.snapshotFile()
+	if file == "" {
+		return nil, nil
+	}
+
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) == true {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshot facetCacheSnapshot
+
+	if err = json.Unmarshal(bytes, &snapshot); err != nil {
+		return nil, err
+	}
+
+	if snapshot.ConfigHash != f.searchCtx.pool.configHash {
+		return nil, fmt.Errorf("snapshot was saved under a different configuration")
+	}
+
+	return &snapshot, nil
+}
+
+func (f *facetCache) loadFacets() {
+	// populate the cache from a saved snapshot, if one is usable
+
+	snapshot, err := f.loadSnapshot()
+	if err != nil {
+		f.searchCtx.warn("[CACHE] ignoring snapshot %s: %s", f.snapshotFile(), err.Error())
+		return
+	}
+
+	if snapshot == nil {
+		return
+	}
+
+	maxAge := time.Duration(integerWithMinimum(f.searchCtx.pool.config.Global.Service.FacetCache.MaxSnapshotAge, 0)) * time.Second
+
+	entries := make(map[facetCacheKey]*facetCacheEntry)
+
+	for _, e := range snapshot.Entries {
+		age := time.Since(e.Created).Round(time.Second)
+
+		if maxAge > 0 && age > maxAge {
+			f.searchCtx.warn("[CACHE] ignoring snapshot entry for resource type [%s] (authenticated: %v): too old (%s)", e.ResourceType, e.Authenticated, age)
+			continue
+		}
+
+		f.searchCtx.log("[CACHE] loaded snapshot entry for resource type [%s] (authenticated: %v) (age: %s; index version: [%s])", e.ResourceType, e.Authenticated, age, e.IndexVersion)
+
+		entries[facetCacheKey{resourceType: e.ResourceType, authenticated: e.Authenticated}] = newFacetCacheEntry(e.Facets, e.Created, e.IndexVersion)
+	}
+
+	f.state.Store(&facetCacheState{entries: entries})
+}
@@ -2,27 +2,72 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/uvalib/virgo4-api/v4api"
+	"github.com/uvalib/virgo4-jwt/v4jwt"
 )
 
+// facets are cached for each auth level (as some facets use different fields for
+// authenticated users), and, for the local cache, for each supported resource type.
+//
+// cached state is immutable once published: each refresh builds a new state and swaps it
+// in atomically, so request goroutines always see a consistent set of entries.
+
+type facetCacheKey struct {
+	resourceType  string // resource type context value, or empty for no selected resource type
+	authenticated bool
+}
+
+type facetCacheEntry struct {
+	facets       []v4api.Facet
+	facetMap     map[string]*v4api.Facet
+	updated      time.Time // when the facets were retrieved from solr (zero if never)
+	indexVersion string    // solr index version of the facets, if known
+	lastAttempt  time.Time // when a refresh was last attempted
+	lastError    string    // error from the last refresh attempt, if it failed
+}
+
+type facetCacheState struct {
+	entries map[facetCacheKey]*facetCacheEntry
+}
+
 type facetCache struct {
+	name            string
 	searchCtx       *searchContext
 	startupDelay    int
 	refreshInterval int
-	currentFacets   *[]v4api.Facet
-	facetMap        map[string]*v4api.Facet
+	global          bool
+	state           atomic.Pointer[facetCacheState]
+	refreshMutex    sync.Mutex // serializes scheduled and forced refreshes
+}
+
+type facetCacheEntryStatus struct {
+	ResourceType  string `json:"resource_type,omitempty"`
+	Authenticated bool   `json:"authenticated"`
+	Cached        bool   `json:"cached"`
+	Age           string `json:"age,omitempty"`
+	IndexVersion  string `json:"index_version,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
 }
 
 func newFacetCache(pool *poolContext, delay int, interval int, globalFlag bool) *facetCache {
 	f := facetCache{
+		name:            "local",
 		startupDelay:    delay,
 		refreshInterval: interval,
-		currentFacets:   nil,
-		facetMap:        nil,
+		global:          globalFlag,
+	}
+
+	if globalFlag == true {
+		f.name = "global"
 	}
 
+	f.state.Store(&facetCacheState{entries: make(map[facetCacheKey]*facetCacheEntry)})
+
 	// create a search context
 
 	c := clientContext{}
@@ -47,53 +92,189 @@ func newFacetCache(pool *poolContext, delay int, interval int, globalFlag bool)
 
 	f.searchCtx = &s
 
+	f.loadFacets()
+
 	go f.monitorFacets()
 
 	return &f
 }
 
+func newFacetCacheEntry(facets []v4api.Facet, updated time.Time, indexVersion string) *facetCacheEntry {
+	e := facetCacheEntry{
+		facets:       facets,
+		facetMap:     make(map[string]*v4api.Facet),
+		updated:      updated,
+		indexVersion: indexVersion,
+	}
+
+	for i := range e.facets {
+		facet := &e.facets[i]
+		e.facetMap[facet.ID] = facet
+	}
+
+	return &e
+}
+
+func (f *facetCache) keys() []facetCacheKey {
+	// the global cache only covers pre-search filters, which are not resource type specific
+
+	resourceTypes := []string{""}
+	if f.global == false {
+		for _, val := range f.searchCtx.pool.config.Global.ResourceTypes.SupportedContexts {
+			// supported contexts may be configured by label; requests are matched by value
+			if ctx := f.searchCtx.pool.maps.resourceTypeContexts[val]; ctx != nil {
+				resourceTypes = append(resourceTypes, ctx.Value)
+			}
+		}
+	}
+
+	var keys []facetCacheKey
+
+	for _, authenticated := range []bool{false, true} {
+		for _, resourceType := range resourceTypes {
+			keys = append(keys, facetCacheKey{resourceType: resourceType, authenticated: authenticated})
+		}
+	}
+
+	return keys
+}
+
 func (f *facetCache) monitorFacets() {
+	// stops once the pool context is retired, e.g. by a configuration reload
+
+	pool := f.searchCtx.pool
+
 	if f.startupDelay > 0 {
 		f.searchCtx.log("[CACHE] initialization delayed for %d seconds", f.startupDelay)
-		time.Sleep(time.Duration(f.startupDelay) * time.Second)
+		if pool.wait(f.startupDelay) == false {
+			return
+		}
 	}
 
 	for {
 		f.refreshFacets()
 		f.searchCtx.log("[CACHE] refresh scheduled in %d seconds", f.refreshInterval)
-		time.Sleep(time.Duration(f.refreshInterval) * time.Second)
+		if pool.wait(f.refreshInterval) == false {
+			f.searchCtx.log("[CACHE] stopped")
+			return
+		}
 	}
 }
 
 func (f *facetCache) refreshFacets() {
+	f.refreshMutex.Lock()
+	defer f.refreshMutex.Unlock()
+
 	f.searchCtx.log("[CACHE] refreshing solr facets...")
 
-	if resp := f.searchCtx.getPoolQueryResults(); resp.err != nil {
-		f.searchCtx.err("[CACHE] query error: %s", resp.err.Error())
-		return
+	// start from the current entries, so that any that fail to refresh are kept
+
+	current := f.state.Load()
+
+	entries := make(map[facetCacheKey]*facetCacheEntry)
+	for key, entry := range current.entries {
+		entries[key] = entry
+	}
+
+	refreshed := 0
+
+	for _, key := range f.keys() {
+		now := time.Now()
+
+		facets, err := f.queryFacets(key)
+		if err != nil {
+			f.searchCtx.err("[CACHE] query error for resource type [%s] (authenticated: %v): %s", key.resourceType, key.authenticated, err.Error())
+
+			// entries are never modified once published, so record the error on a copy
+			entry := facetCacheEntry{}
+			if old := entries[key]; old != nil {
+				entry = *old
+			}
+
+			entry.lastAttempt = now
+			entry.lastError = err.Error()
+
+			entries[key] = &entry
+			continue
+		}
+
+		entry := newFacetCacheEntry(facets, now, f.searchCtx.pool.solr.cache.currentVersion())
+		entry.lastAttempt = now
+
+		entries[key] = entry
+		refreshed++
 	}
 
-	f.currentFacets = &f.searchCtx.virgo.poolRes.FacetList
+	f.state.Store(&facetCacheState{entries: entries})
+
+	// a retired pool context's snapshot must not overwrite that of its replacement
+	if refreshed == 0 || f.searchCtx.pool.stopped() == true {
+		return
+	}
 
-	f.facetMap = make(map[string]*v4api.Facet)
-	for i := range *f.currentFacets {
-		facet := &(*f.currentFacets)[i]
-		f.facetMap[facet.ID] = facet
+	if err := f.saveSnapshot(entries); err != nil {
+		f.searchCtx.warn("[CACHE] failed to save snapshot: %s", err.Error())
 	}
 }
 
-func (f *facetCache) getSpecifiedFilters(filterIDs []string) ([]v4api.Facet, error) {
-	// create copy of memory reference in case lists updates while we are running
-	currentFacetMap := f.facetMap
+func (f *facetCache) queryFacets(key facetCacheKey) ([]v4api.Facet, error) {
+	// each refresh gets its own search context, as its request may be coalesced with others
+	s := f.searchCtx.copySearchContext()
+
+	if key.authenticated == true {
+		s.client.claims = &v4jwt.V4Claims{IsUVA: true}
+	}
+
+	if key.resourceType == "" {
+		if resp := s.getPoolQueryResults(); resp.err != nil {
+			return nil, resp.err
+		}
+
+		return s.virgo.poolRes.FacetList, nil
+	}
 
-	if f.currentFacets == nil {
+	// facets for a selected resource type are exactly those of a facets request selecting it
+
+	var filter v4api.Filter
+
+	filter.Facets = []struct {
+		FacetID string `json:"facet_id"`
+		Value   string `json:"value"`
+	}{{FacetID: "pool_f", Value: key.resourceType}}
+
+	s.virgo.req.Filters = []v4api.Filter{filter}
+
+	s.virgo.flags.facetCache = false
+	s.virgo.flags.globalFacetCache = false
+	s.virgo.flags.bypassFacetCache = true
+
+	facets, resp := s.performFacetsRequest()
+	if resp.err != nil {
+		return nil, resp.err
+	}
+
+	return facets, nil
+}
+
+func (f *facetCache) getEntry(key facetCacheKey) (*facetCacheEntry, error) {
+	entry := f.state.Load().entries[key]
+	if entry == nil || entry.updated.IsZero() == true {
 		return nil, errors.New("facets have not been cached yet")
 	}
 
+	return entry, nil
+}
+
+func (f *facetCache) getSpecifiedFilters(authenticated bool, filterIDs []string) ([]v4api.Facet, error) {
+	entry, err := f.getEntry(facetCacheKey{authenticated: authenticated})
+	if err != nil {
+		return nil, err
+	}
+
 	var filters []v4api.Facet
 
 	for _, id := range filterIDs {
-		filter := currentFacetMap[id]
+		filter := entry.facetMap[id]
 
 		// assume any missing filters are due to them not existing in solr
 		if filter == nil {
@@ -106,6 +287,56 @@ func (f *facetCache) getSpecifiedFilters(filterIDs []string) ([]v4api.Facet, err
 	return filters, nil
 }
 
-func (f *facetCache) getPreSearchFilters() ([]v4api.Facet, error) {
-	return f.getSpecifiedFilters(f.searchCtx.pool.config.Global.Mappings.Configured.FilterIDs)
+func (f *facetCache) getResourceTypeFilters(authenticated bool, resourceType string) ([]v4api.Facet, error) {
+	entry, err := f.getEntry(facetCacheKey{resourceType: resourceType, authenticated: authenticated})
+	if err != nil {
+		return nil, err
+	}
+
+	// callers may modify the list they are given
+	facets := make([]v4api.Facet, len(entry.facets))
+	copy(facets, entry.facets)
+
+	return facets, nil
+}
+
+func (f *facetCache) getPreSearchFilters(authenticated bool) ([]v4api.Facet, error) {
+	return f.getSpecifiedFilters(authenticated, f.searchCtx.pool.config.Global.Mappings.Configured.FilterIDs)
+}
+
+func (f *facetCache) status() []facetCacheEntryStatus {
+	entries := f.state.Load().entries
+
+	var statuses []facetCacheEntryStatus
+
+	for _, key := range f.keys() {
+		st := facetCacheEntryStatus{ResourceType: key.resourceType, Authenticated: key.authenticated}
+
+		if entry := entries[key]; entry != nil {
+			st.Cached = entry.updated.IsZero() == false
+			st.IndexVersion = entry.indexVersion
+			st.LastError = entry.lastError
+
+			if st.Cached == true {
+				st.Age = time.Since(entry.updated).Round(time.Second).String()
+			}
+		}
+
+		statuses = append(statuses, st)
+	}
+
+	return statuses
+}
+
+func (st facetCacheEntryStatus) healthCheckName(cacheName string) string {
+	auth := "anonymous"
+	if st.Authenticated == true {
+		auth = "authenticated"
+	}
+
+	if st.ResourceType == "" {
+		return fmt.Sprintf("facet_cache_%s_%s", cacheName, auth)
+	}
+
+	return fmt.Sprintf("facet_cache_%s_%s_%s", cacheName, st.ResourceType, auth)
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+)
+
+// hierarchy facets: two-level facets, such as library > location.  v4 facet buckets cannot
+// be nested, so each parent bucket is followed by its child buckets, whose values name both
+// levels joined by a separator (e.g. "Alderman > Stacks").  selecting a child value applies
+// both the parent and child filters.
+
+const defaultHierarchySeparator = " > "
+
+func (def *poolConfigFilter) hierarchySeparator() string {
+	if def.Hierarchy.Separator == "" {
+		return defaultHierarchySeparator
+	}
+
+	return def.Hierarchy.Separator
+}
+
+func (def *poolConfigFilter) hierarchyValue(parent string, child string) string {
+	return parent + def.hierarchySeparator() + child
+}
+
+func (def *poolConfigFilter) splitHierarchyValue(value string) (string, string) {
+	// returns the parent value, and the child value if any
+
+	parts := strings.SplitN(value, def.hierarchySeparator(), 2)
+
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/uvalib/virgo4-api/v4api"
+)
+
+// paging through the values of a single facet, optionally restricted to values beginning
+// with a prefix, so that facets too large to return in full can still be explored
+
+const defaultFacetPageLimit = 20
+const maxFacetPageLimit = 500
+
+type facetPageRequest struct {
+	v4api.SearchRequest
+	Prefix string `json:"prefix"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+}
+
+type facetPage struct {
+	id     string
+	prefix string
+	offset int
+	limit  int
+}
+
+type facetPageResponse struct {
+	v4api.Facet
+	Prefix string `json:"prefix"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+	Total  int    `json:"total"` // number of facet values matching the prefix
+}
+
+func (s *searchContext) handleFacetPageRequest() searchResponse {
+	s.virgo.endpoint = "facet page"
+
+	var req facetPageRequest
+
+	if resp := s.parseRequest(&req); resp.err != nil {
+		return resp
+	}
+
+	s.virgo.req = req.SearchRequest
+
+	// only facets are of interest, not records
+	s.virgo.req.Pagination = v4api.Pagination{Start: 0, Rows: 0}
+	s.virgo.flags.requestFacets = true
+
+	if err := s.validateSearchRequest(); err != nil {
+		return searchResponse{status: http.StatusBadRequest, err: err}
+	}
+
+	facetID := s.client.ginCtx.Param("facetID")
+
+	facetDef := s.resourceTypeCtx.filterMap[facetID]
+	if facetDef == nil || s.resourceTypeCtx.returnsFacet(facetID) == false {
+		return searchResponse{status: http.StatusNotFound, err: fmt.Errorf("unrecognized facet: [%s]", facetID)}
+	}
+
+	// only plain value facets can be paged; others have a fixed or structured set of buckets
+	switch facetDef.Type {
+	case "boolean", "component", "range", "hierarchy":
+		return searchResponse{status: http.StatusBadRequest, err: fmt.Errorf("facet does not support paging: [%s]", facetID)}
+	}
+
+	if req.Prefix != "" {
+		if err := validateSolrValue("facet prefix", req.Prefix); err != nil {
+			return searchResponse{status: http.StatusBadRequest, err: err}
+		}
+	}
+
+	if req.Offset < 0 {
+		return searchResponse{status: http.StatusBadRequest, err: fmt.Errorf("invalid facet offset: %d", req.Offset)}
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = facetDef.Solr.Limit
+	}
+	if limit <= 0 {
+		limit = defaultFacetPageLimit
+	}
+	if limit > maxFacetPageLimit {
+		limit = maxFacetPageLimit
+	}
+
+	s.virgo.facetPage = &facetPage{id: facetID, prefix: req.Prefix, offset: req.Offset, limit: limit}
+
+	res := facetPageResponse{
+		Facet:  s.newFacetFromDefinition(facetDef),
+		Prefix: req.Prefix,
+		Offset: req.Offset,
+		Limit:  limit,
+	}
+
+	res.Buckets = []v4api.FacetBucket{}
+
+	// nothing can match an unsupported filter
+	if s.virgo.invalidFilters == true {
+		return searchResponse{status: http.StatusOK, data: res}
+	}
+
+	if resp := s.getPoolQueryResults(); resp.err != nil {
+		return resp
+	}
+
+	for _, facet := range s.virgo.poolRes.FacetList {
+		if facet.ID == facetID {
+			res.Buckets = facet.Buckets
+		}
+	}
+
+	res.Total = s.solr.res.Facets[facetID].NumBuckets
+
+	return searchResponse{status: http.StatusOK, data: res}
+}
@@ -14,6 +14,7 @@ import (
 func (p *poolContext) searchHandler(c *gin.Context) {
 	cl := clientContext{}
 	cl.init(p, c)
+	defer cl.cancel()
 
 	s := searchContext{}
 	s.init(p, &cl)
@@ -28,6 +29,7 @@ func (p *poolContext) searchHandler(c *gin.Context) {
 func (p *poolContext) facetsHandler(c *gin.Context) {
 	cl := clientContext{}
 	cl.init(p, c)
+	defer cl.cancel()
 
 	s := searchContext{}
 	s.init(p, &cl)
@@ -39,9 +41,81 @@ func (p *poolContext) facetsHandler(c *gin.Context) {
 	c.JSON(resp.status, resp.data)
 }
 
+func (p *poolContext) facetPageHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+	defer cl.cancel()
+
+	s := searchContext{}
+	s.init(p, &cl)
+
+	cl.logRequest()
+	resp := s.handleFacetPageRequest()
+	cl.logResponse(resp)
+
+	if resp.err != nil {
+		c.String(resp.status, resp.err.Error())
+		return
+	}
+
+	c.JSON(resp.status, resp.data)
+}
+
+func (p *poolContext) exportHandler(c *gin.Context) {
+	// exports are expected to outlast the request budget; only stop if the client goes away
+	cl := clientContext{}
+	cl.initWithBudget(p, c, 0)
+	defer cl.cancel()
+
+	s := searchContext{}
+	s.init(p, &cl)
+
+	cl.logRequest()
+
+	resp := s.authorizeExport()
+	if resp.err == nil {
+		resp = s.handleExportRequest()
+	}
+
+	cl.logResponse(resp)
+
+	// once streaming has started, errors can only be logged
+	if c.Writer.Written() == true {
+		return
+	}
+
+	if resp.err != nil {
+		c.String(resp.status, resp.err.Error())
+		return
+	}
+
+	c.Status(resp.status)
+}
+
+func (p *poolContext) suggestHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+	defer cl.cancel()
+
+	s := searchContext{}
+	s.init(p, &cl)
+
+	cl.logRequest()
+	resp := s.handleSuggestRequest()
+	cl.logResponse(resp)
+
+	if resp.err != nil {
+		c.String(resp.status, resp.err.Error())
+		return
+	}
+
+	c.JSON(resp.status, resp.data)
+}
+
 func (p *poolContext) filtersHandler(c *gin.Context) {
 	cl := clientContext{}
 	cl.init(p, c)
+	defer cl.cancel()
 
 	s := searchContext{}
 	s.init(p, &cl)
@@ -54,6 +128,7 @@ func (p *poolContext) filtersHandler(c *gin.Context) {
 func (p *poolContext) resourceHandler(c *gin.Context) {
 	cl := clientContext{}
 	cl.init(p, c)
+	defer cl.cancel()
 
 	s := searchContext{}
 	s.init(p, &cl)
@@ -70,12 +145,33 @@ func (p *poolContext) resourceHandler(c *gin.Context) {
 	c.JSON(resp.status, resp.data)
 }
 
+func (p *poolContext) similarHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+	defer cl.cancel()
+
+	s := searchContext{}
+	s.init(p, &cl)
+
+	cl.logRequest()
+	resp := s.handleSimilarRequest()
+	cl.logResponse(resp)
+
+	if resp.err != nil {
+		c.String(resp.status, resp.err.Error())
+		return
+	}
+
+	c.JSON(resp.status, resp.data)
+}
+
 func (p *poolContext) ignoreHandler(c *gin.Context) {
 }
 
 func (p *poolContext) versionHandler(c *gin.Context) {
 	cl := clientContext{}
 	cl.init(p, c)
+	defer cl.cancel()
 
 	c.JSON(http.StatusOK, p.version)
 }
@@ -83,42 +179,90 @@ func (p *poolContext) versionHandler(c *gin.Context) {
 func (p *poolContext) identifyHandler(c *gin.Context) {
 	cl := clientContext{}
 	cl.init(p, c)
+	defer cl.cancel()
+
 	c.JSON(http.StatusOK, p.identity)
 }
 
 func (p *poolContext) providersHandler(c *gin.Context) {
 	cl := clientContext{}
 	cl.init(p, c)
+	defer cl.cancel()
+
 	c.JSON(http.StatusOK, p.providers)
 }
 
 func (p *poolContext) healthCheckHandler(c *gin.Context) {
 	cl := clientContext{}
 	cl.init(p, c)
-
-	s := searchContext{}
-	s.init(p, &cl)
-
-	ping := s.handlePingRequest()
+	defer cl.cancel()
 
 	// build response
 
-	internalServiceError := false
-
 	type hcResp struct {
 		Healthy bool   `json:"healthy"`
 		Message string `json:"message,omitempty"`
 	}
 
+	hcMap := make(map[string]hcResp)
+
+	// ping each solr replica, reporting its rotation and circuit breaker state.
+	// solr as a whole is healthy as long as at least one replica is.
+
+	healthyReplicas := 0
+
+	for i, replica := range p.solr.replicas {
+		s := searchContext{}
+		s.init(p, &cl)
+
+		ping := s.handlePingRequest(replica)
+		st := replica.status()
+
+		msg := fmt.Sprintf("%s: in rotation: %t; breaker: %s (%d consecutive failures)", st.host, st.inRotation, st.breaker.State, st.breaker.Failures)
+		if st.breaker.State == breakerOpen {
+			msg += fmt.Sprintf("; retry in %d ms", st.breaker.RetryIn)
+		}
+
+		hcReplica := hcResp{Healthy: true, Message: msg}
+		if ping.err != nil {
+			hcReplica = hcResp{Healthy: false, Message: fmt.Sprintf("%s; ping error: %s", msg, ping.err.Error())}
+		} else {
+			healthyReplicas++
+		}
+
+		hcMap[fmt.Sprintf("solr_replica_%d", i)] = hcReplica
+	}
+
+	internalServiceError := false
+
 	hcSolr := hcResp{Healthy: true}
-	if ping.err != nil {
+	if healthyReplicas == 0 {
 		internalServiceError = true
-		hcSolr = hcResp{Healthy: false, Message: ping.err.Error()}
+		hcSolr = hcResp{Healthy: false, Message: "no healthy solr replicas"}
+	} else if healthyReplicas < len(p.solr.replicas) {
+		hcSolr.Message = fmt.Sprintf("%d of %d replicas healthy", healthyReplicas, len(p.solr.replicas))
 	}
 
-	hcMap := make(map[string]hcResp)
 	hcMap["solr"] = hcSolr
 
+	// report the state of each facet cache snapshot.  stale or missing snapshots do not
+	// make the service unhealthy, as requests fall back to querying solr directly.
+
+	for _, cache := range []*facetCache{p.globalFacetCache, p.localFacetCache} {
+		for _, st := range cache.status() {
+			msg := "not cached"
+			if st.Cached == true {
+				msg = fmt.Sprintf("age: %s; index version: [%s]", st.Age, st.IndexVersion)
+			}
+
+			if st.LastError != "" {
+				msg += fmt.Sprintf("; last error: %s", st.LastError)
+			}
+
+			hcMap[st.healthCheckName(cache.name)] = hcResp{Healthy: st.Cached == true && st.LastError == "", Message: msg}
+		}
+	}
+
 	hcStatus := http.StatusOK
 	if internalServiceError == true {
 		hcStatus = http.StatusInternalServerError
@@ -127,6 +271,40 @@ func (p *poolContext) healthCheckHandler(c *gin.Context) {
 	c.JSON(hcStatus, hcMap)
 }
 
+func (p *poolContext) metricsHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+	defer cl.cancel()
+
+	type metricsResp struct {
+		SolrCache     solrCacheStats `json:"solr_cache"`
+		SolrCoalesced int64          `json:"solr_coalesced_requests"`
+	}
+
+	c.JSON(http.StatusOK, metricsResp{SolrCache: p.solr.cache.stats(), SolrCoalesced: p.solr.inflight.coalescedCount()})
+}
+
+func (p *poolContext) facetCacheRefreshHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+	defer cl.cancel()
+
+	cl.logRequest()
+
+	// refresh synchronously, so that the response reflects the outcome
+	p.globalFacetCache.refreshFacets()
+	p.localFacetCache.refreshFacets()
+
+	res := map[string][]facetCacheEntryStatus{
+		p.globalFacetCache.name: p.globalFacetCache.status(),
+		p.localFacetCache.name:  p.localFacetCache.status(),
+	}
+
+	cl.logResponse(searchResponse{status: http.StatusOK})
+
+	c.JSON(http.StatusOK, res)
+}
+
 func getBearerToken(authorization string) (string, error) {
 	components := strings.Split(strings.Join(strings.Fields(authorization), " "), " ")
 
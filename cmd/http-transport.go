@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// resilient transport for external services: retries with jittered backoff
+// for idempotent requests, plus a per-host circuit breaker
+
+// default cap on retry backoff, in milliseconds
+const defaultRetryMaxDelay = 2000
+
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+type circuitBreaker struct {
+	mu          sync.Mutex
+	host        string
+	threshold   int           // consecutive failures before opening; 0 disables the breaker
+	openTimeout time.Duration // how long to fail fast before allowing a trial request
+	state       string
+	failures    int
+	openedAt    time.Time
+	lastError   string
+}
+
+type circuitBreakerStatus struct {
+	Host      string `json:"host"`
+	State     string `json:"state"`
+	Failures  int    `json:"failures"`
+	RetryIn   int64  `json:"retry_in_ms,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// an error that knows which http status it should be reported to clients as
+type httpStatusError struct {
+	status int
+	err    error
+}
+
+func (e *httpStatusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *httpStatusError) Unwrap() error {
+	return e.err
+}
+
+func statusFromError(err error, fallback int) int {
+	var se *httpStatusError
+
+	if errors.As(err, &se) == true {
+		return se.status
+	}
+
+	return fallback
+}
+
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+func contextStatusError(err error) *httpStatusError {
+	// map a done request context to the status we report to clients
+
+	if errors.Is(err, context.DeadlineExceeded) == true {
+		return &httpStatusError{status: http.StatusGatewayTimeout, err: errors.New("request exceeded its time budget")}
+	}
+
+	return &httpStatusError{status: http.StatusRequestTimeout, err: errors.New("request was cancelled by the client")}
+}
+
+func newRetryPolicy(cfg poolConfigHTTPRetry) retryPolicy {
+	r := retryPolicy{
+		maxRetries: integerWithMinimum(cfg.MaxRetries, 0),
+		baseDelay:  time.Duration(integerWithMinimum(cfg.BaseDelay, 50)) * time.Millisecond,
+		maxDelay:   time.Duration(defaultRetryMaxDelay) * time.Millisecond,
+	}
+
+	if cfg.MaxDelay != "" {
+		r.maxDelay = time.Duration(integerWithMinimum(cfg.MaxDelay, 1)) * time.Millisecond
+	}
+
+	if r.maxDelay < r.baseDelay {
+		r.maxDelay = r.baseDelay
+	}
+
+	return r
+}
+
+func (r retryPolicy) backoff(attempt int) time.Duration {
+	// exponential backoff with jitter: somewhere between half and all of the capped delay
+
+	delay := r.baseDelay << uint(attempt)
+	if delay <= 0 || delay > r.maxDelay {
+		delay = r.maxDelay
+	}
+
+	half := int64(delay / 2)
+
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func newCircuitBreaker(host string, cfg poolConfigHTTPCircuitBreaker) *circuitBreaker {
+	b := circuitBreaker{
+		host:        host,
+		threshold:   integerWithMinimum(cfg.FailureThreshold, 0),
+		openTimeout: time.Duration(integerWithMinimum(cfg.OpenTimeout, 1)) * time.Second,
+		state:       breakerClosed,
+	}
+
+	return &b
+}
+
+func (b *circuitBreaker) allow() bool {
+	if b == nil || b.threshold == 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+
+		// let a single trial request through
+		b.state = breakerHalfOpen
+		return true
+
+	case breakerHalfOpen:
+		// trial request already in flight
+		return false
+	}
+
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	if b == nil || b.threshold == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+func (b *circuitBreaker) failure(err error) {
+	if b == nil || b.threshold == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastError = err.Error()
+
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) abandon() {
+	// the request was abandoned before its outcome was known.
+	// if it was the trial request, let the next request try again.
+
+	if b == nil || b.threshold == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+func (b *circuitBreaker) status() circuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := circuitBreakerStatus{
+		Host:      b.host,
+		State:     b.state,
+		Failures:  b.failures,
+		LastError: b.lastError,
+	}
+
+	if b.threshold == 0 {
+		st.State = "disabled"
+	}
+
+	if b.state == breakerOpen {
+		st.RetryIn = int64((b.openTimeout - time.Since(b.openedAt)) / time.Millisecond)
+		if st.RetryIn < 0 {
+			st.RetryIn = 0
+		}
+	}
+
+	return st
+}
+
+func classifyTransportError(url string, err error) *httpStatusError {
+	// map transport-level errors to the status we report to clients
+
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		return &httpStatusError{status: http.StatusServiceUnavailable, err: fmt.Errorf("%s unavailable (circuit breaker open)", url)}
+
+	case errors.As(err, &netErr) == true && netErr.Timeout() == true:
+		return &httpStatusError{status: http.StatusRequestTimeout, err: fmt.Errorf("%s timed out", url)}
+
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return &httpStatusError{status: http.StatusServiceUnavailable, err: fmt.Errorf("%s refused connection", url)}
+	}
+
+	return &httpStatusError{status: http.StatusBadGateway, err: err}
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusBadGateway:
+	case http.StatusServiceUnavailable:
+	case http.StatusGatewayTimeout:
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (h *httpClientContext) do(req *http.Request, idempotent bool) (*http.Response, error) {
+	// performs the request, retrying idempotent requests on transient failures.
+	// transport errors are returned as *httpStatusError.
+
+	retries := 0
+	if idempotent == true {
+		retries = h.retry.maxRetries
+	}
+
+	var lastErr error
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			// back off, unless the request is abandoned in the meantime
+			select {
+			case <-time.After(h.retry.backoff(attempt - 1)):
+			case <-req.Context().Done():
+				return nil, contextStatusError(req.Context().Err())
+			}
+
+			// rewind the request body, if any
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, classifyTransportError(h.url, err)
+				}
+				req.Body = body
+			}
+		}
+
+		if h.breaker.allow() == false {
+			return nil, classifyTransportError(h.url, errCircuitOpen)
+		}
+
+		res, err := h.client.Do(req)
+
+		// an abandoned request says nothing about the health of the host
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			h.breaker.abandon()
+			if res != nil {
+				res.Body.Close()
+			}
+			return nil, contextStatusError(ctxErr)
+		}
+
+		if err != nil {
+			h.breaker.failure(err)
+			lastErr = err
+			continue
+		}
+
+		if isRetryableStatus(res.StatusCode) == true {
+			h.breaker.failure(fmt.Errorf("http status %d", res.StatusCode))
+
+			if attempt < retries {
+				res.Body.Close()
+				continue
+			}
+
+			// out of retries; let the caller deal with whatever came back
+			return res, nil
+		}
+
+		h.breaker.success()
+
+		return res, nil
+	}
+
+	return nil, classifyTransportError(h.url, lastErr)
+}
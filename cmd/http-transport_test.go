@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	b := newCircuitBreaker("solr", poolConfigHTTPCircuitBreaker{FailureThreshold: "2", OpenTimeout: "60"})
+
+	expire := func() {
+		// pretend the open timeout has passed
+		b.mu.Lock()
+		b.openedAt = time.Now().Add(-b.openTimeout)
+		b.mu.Unlock()
+	}
+
+	steps := []struct {
+		name  string
+		event func() bool
+		want  bool // result of allow(), where applicable
+		state string
+	}{
+		{name: "closed allows", event: b.allow, want: true, state: breakerClosed},
+		{name: "failure below threshold", event: func() bool { b.failure(errors.New("one")); return true }, want: true, state: breakerClosed},
+		{name: "failure at threshold", event: func() bool { b.failure(errors.New("two")); return true }, want: true, state: breakerOpen},
+		{name: "open fails fast", event: b.allow, want: false, state: breakerOpen},
+		{name: "timeout allows trial", event: func() bool { expire(); return b.allow() }, want: true, state: breakerHalfOpen},
+		{name: "one trial at a time", event: b.allow, want: false, state: breakerHalfOpen},
+		{name: "failed trial reopens", event: func() bool { b.failure(errors.New("three")); return true }, want: true, state: breakerOpen},
+		{name: "reopened fails fast", event: b.allow, want: false, state: breakerOpen},
+		{name: "timeout allows another trial", event: func() bool { expire(); return b.allow() }, want: true, state: breakerHalfOpen},
+		{name: "abandoned trial reopens", event: func() bool { b.abandon(); return true }, want: true, state: breakerOpen},
+		{name: "abandoned trial can be retried", event: b.allow, want: true, state: breakerHalfOpen},
+		{name: "successful trial closes", event: func() bool { b.success(); return true }, want: true, state: breakerClosed},
+		{name: "closed allows again", event: b.allow, want: true, state: breakerClosed},
+	}
+
+	for _, step := range steps {
+		if got := step.event(); got != step.want {
+			t.Fatalf("%s: got allow() = %v, want %v", step.name, got, step.want)
+		}
+
+		if st := b.status(); st.State != step.state {
+			t.Fatalf("%s: got state [%s], want [%s]", step.name, st.State, step.state)
+		}
+	}
+
+	if st := b.status(); st.Failures != 0 || st.LastError != "three" {
+		t.Errorf("got %d failures (last error: [%s]) after closing, want 0 ([three])", st.Failures, st.LastError)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	for _, b := range []*circuitBreaker{nil, newCircuitBreaker("solr", poolConfigHTTPCircuitBreaker{FailureThreshold: "0"})} {
+		for i := 0; i < 5; i++ {
+			b.failure(errors.New("failed"))
+		}
+
+		if b.allow() == false {
+			t.Errorf("disabled breaker refused a request")
+		}
+	}
+}
+
+func TestHTTPClientRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int // per attempt; the last is repeated
+		idempotent   bool
+		threshold    string
+		wantStatus   int // response status, or error status if wantErr
+		wantErr      bool
+		wantRequests int32
+	}{
+		{name: "success", statuses: []int{http.StatusOK}, idempotent: true, wantStatus: http.StatusOK, wantRequests: 1},
+		{name: "recovers", statuses: []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, idempotent: true, wantStatus: http.StatusOK, wantRequests: 3},
+		{name: "gives up", statuses: []int{http.StatusServiceUnavailable}, idempotent: true, wantStatus: http.StatusServiceUnavailable, wantRequests: 3},
+		{name: "not idempotent", statuses: []int{http.StatusServiceUnavailable}, idempotent: false, wantStatus: http.StatusServiceUnavailable, wantRequests: 1},
+		{name: "not retryable", statuses: []int{http.StatusInternalServerError}, idempotent: true, wantStatus: http.StatusInternalServerError, wantRequests: 1},
+		{name: "breaker opens", statuses: []int{http.StatusGatewayTimeout}, idempotent: true, threshold: "2", wantStatus: http.StatusServiceUnavailable, wantErr: true, wantRequests: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&requests, 1))
+				if n > len(tt.statuses) {
+					n = len(tt.statuses)
+				}
+				w.WriteHeader(tt.statuses[n-1])
+			}))
+			defer srv.Close()
+
+			h := httpClientContext{
+				client:  http.DefaultClient,
+				url:     srv.URL,
+				enabled: true,
+				retry:   retryPolicy{maxRetries: 2, baseDelay: time.Millisecond, maxDelay: time.Millisecond},
+				breaker: newCircuitBreaker(srv.URL, poolConfigHTTPCircuitBreaker{FailureThreshold: tt.threshold}),
+			}
+
+			req, err := http.NewRequestWithContext(context.Background(), "GET", srv.URL, nil)
+			if err != nil {
+				t.Fatalf("NewRequest() failed: %s", err.Error())
+			}
+
+			res, err := h.do(req, tt.idempotent)
+
+			if tt.wantErr == true {
+				if err == nil {
+					res.Body.Close()
+					t.Fatalf("expected an error, got status %d", res.StatusCode)
+				}
+
+				if got := statusFromError(err, 0); got != tt.wantStatus {
+					t.Errorf("got error status %d, want %d", got, tt.wantStatus)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+
+				res.Body.Close()
+
+				if res.StatusCode != tt.wantStatus {
+					t.Errorf("got status %d, want %d", res.StatusCode, tt.wantStatus)
+				}
+			}
+
+			if got := atomic.LoadInt32(&requests); got != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
@@ -23,24 +23,39 @@ func main() {
 	var cfg *poolConfig
 	var cfgFile string
 	var cfgOutFile string
+	var validateFile string
+	var schemaFile string
+	var err error
 	flag.StringVar(&cfgFile, "cfg", "", "local cfg file")
 	flag.StringVar(&cfgOutFile, "o", "", "dump config to this file ")
+	flag.StringVar(&validateFile, "validate", "", "validate this cfg file, report any problems, and exit")
+	flag.StringVar(&schemaFile, "schema", "", "solr schema json file to check fields against when validating")
 	flag.Parse()
+	if validateFile != "" {
+		log.Printf("===> validate config: %s", validateFile)
+		report := validateConfigFile(validateFile, schemaFile)
+		bytes, err := json.MarshalIndent(report, "", "   ")
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		fmt.Println(string(bytes))
+		if report.Valid == false {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	if cfgFile != "" {
 		log.Printf("===> load config from: %s", cfgFile)
-		jsonBytes, err := os.ReadFile(cfgFile)
+		cfg, err = loadConfigFile(cfgFile)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
-		var pc poolConfig
-		cErr := json.Unmarshal(jsonBytes, &pc)
-		if cErr != nil {
-			log.Fatal(cErr)
-		}
-		cfg = &pc
 	} else {
 		log.Printf("===> load config from environment")
-		cfg = loadConfig()
+		cfg, err = loadConfig()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
 		if cfgOutFile != "" {
 			log.Printf("===> dump config to %s and exit", cfgOutFile)
 			cfgF, _ := os.Create(cfgOutFile)
@@ -54,7 +69,14 @@ func main() {
 		}
 	}
 
-	pool := initializePool(cfg)
+	pool, err := initializePool(cfg)
+	if err != nil {
+		log.Printf("[MAIN] exiting due to error(s) above: %s", err.Error())
+		os.Exit(1)
+	}
+
+	// the pool context may be replaced by a config reload; see pool-reload.go
+	service := newPoolService(cfgFile, pool)
 
 	gin.SetMode(gin.ReleaseMode)
 	gin.DisableConsoleColor()
@@ -69,6 +91,8 @@ func main() {
 	corsCfg.AddAllowHeaders("Authorization")
 	router.Use(cors.New(corsCfg))
 
+	router.Use(service.poolHandler)
+
 	//
 	// we are removing Prometheus support for now
 	//
@@ -82,22 +106,31 @@ func main() {
 	//	h.ServeHTTP(c.Writer, c.Request)
 	//})
 
-	router.GET("/favicon.ico", pool.ignoreHandler)
+	router.GET("/favicon.ico", service.handler((*poolContext).ignoreHandler))
+
+	router.GET("/version", service.handler((*poolContext).versionHandler))
+	router.GET("/identify", service.handler((*poolContext).identifyHandler))
+	router.GET("/healthcheck", service.handler((*poolContext).healthCheckHandler))
+	router.GET("/metrics", service.handler((*poolContext).metricsHandler))
 
-	router.GET("/version", pool.versionHandler)
-	router.GET("/identify", pool.identifyHandler)
-	router.GET("/healthcheck", pool.healthCheckHandler)
+	authenticate := service.handler((*poolContext).authenticateHandler)
 
 	if api := router.Group("/api"); api != nil {
-		api.POST("/search", pool.authenticateHandler, pool.searchHandler)
-		api.POST("/search/facets", pool.authenticateHandler, pool.facetsHandler)
-		api.GET("/resource/:id", pool.authenticateHandler, pool.resourceHandler)
-		api.GET("/providers", pool.providersHandler) // No auth needed here
-		api.GET("/filters", pool.authenticateHandler, pool.filtersHandler)
+		api.POST("/search", authenticate, service.handler((*poolContext).searchHandler))
+		api.POST("/search/facets", authenticate, service.handler((*poolContext).facetsHandler))
+		api.POST("/search/facets/:facetID", authenticate, service.handler((*poolContext).facetPageHandler))
+		api.POST("/search/export", authenticate, service.handler((*poolContext).exportHandler))
+		api.GET("/resource/:id", authenticate, service.handler((*poolContext).resourceHandler))
+		api.GET("/resource/:id/similar", authenticate, service.handler((*poolContext).similarHandler))
+		api.GET("/providers", service.handler((*poolContext).providersHandler)) // No auth needed here
+		api.GET("/suggest", authenticate, service.handler((*poolContext).suggestHandler))
+		api.GET("/filters", authenticate, service.handler((*poolContext).filtersHandler))
 	}
 
-	if admin := router.Group("/admin", pool.authenticateHandler, pool.adminHandler); admin != nil {
+	if admin := router.Group("/admin", authenticate, service.handler((*poolContext).adminHandler)); admin != nil {
 		pprof.RouteRegister(admin, "pprof")
+		admin.POST("/facets/refresh", service.handler((*poolContext).facetCacheRefreshHandler))
+		admin.POST("/config/reload", service.reloadHandler)
 	}
 
 	router.Use(static.Serve("/assets", static.LocalFile("./assets", false)))
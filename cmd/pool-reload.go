@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hot configuration reload: a new pool context is built from a fresh read of the config
+// source, and swapped in only if it initializes and validates cleanly.  each request pins
+// the pool context that was current when it arrived, so in-flight requests are unaffected.
+// the retired pool context's background tasks (replica/index monitors, facet caches) stop,
+// and the new pool context starts its own.
+// only configuration loaded from a file can be reloaded; the environment of a running process
+// cannot change, so re-reading it would only ever reproduce the current configuration.
+
+var errReloadUnsupported = errors.New("config was loaded from the environment, which cannot change; reload requires a config file (-cfg)")
+
+type poolService struct {
+	cfgFile      string // config file to load, or empty to load from the environment
+	current      atomic.Pointer[poolContext]
+	reloadMutex  sync.Mutex
+	reloadSignal chan os.Signal
+}
+
+type reloadResponse struct {
+	ConfigHash string `json:"config_hash"`
+	Changed    bool   `json:"changed"`
+}
+
+func newPoolService(cfgFile string, pool *poolContext) *poolService {
+	s := poolService{cfgFile: cfgFile}
+
+	s.current.Store(pool)
+
+	pool.start()
+
+	// reload on SIGHUP
+
+	s.reloadSignal = make(chan os.Signal, 1)
+	signal.Notify(s.reloadSignal, syscall.SIGHUP)
+
+	go s.monitorReloadSignal()
+
+	return &s
+}
+
+func (s *poolService) pool() *poolContext {
+	return s.current.Load()
+}
+
+func (s *poolService) reload() (res reloadResponse, err error) {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	// a configuration problem that validation did not anticipate must not take down the service
+	defer func() {
+		if r := recover(); r != nil {
+			res, err = reloadResponse{}, fmt.Errorf("reload failed: %v", r)
+		}
+	}()
+
+	if s.cfgFile == "" {
+		return reloadResponse{}, errReloadUnsupported
+	}
+
+	log.Printf("[RELOAD] load config from: %s", s.cfgFile)
+
+	cfg, err := loadConfigFile(s.cfgFile)
+	if err != nil {
+		return reloadResponse{}, fmt.Errorf("config load failed: %s", err.Error())
+	}
+
+	pool, err := initializePool(cfg)
+	if err != nil {
+		return reloadResponse{}, fmt.Errorf("config rejected: %s", err.Error())
+	}
+
+	// start the new pool context before it becomes visible, so that no request is served
+	// without its background tasks running
+
+	pool.start()
+
+	old := s.current.Swap(pool)
+	old.stop()
+
+	if pool.config.Global.Service.Port != old.config.Global.Service.Port {
+		log.Printf("[RELOAD] WARNING: port changes require a restart; still listening on %s", old.config.Global.Service.Port)
+	}
+
+	res = reloadResponse{ConfigHash: pool.configHash, Changed: pool.configHash != old.configHash}
+
+	log.Printf("[RELOAD] config reloaded (hash: %s; changed: %v)", res.ConfigHash, res.Changed)
+
+	return res, nil
+}
+
+func (s *poolService) monitorReloadSignal() {
+	for range s.reloadSignal {
+		log.Printf("[RELOAD] received SIGHUP; reloading config")
+
+		if _, err := s.reload(); err != nil {
+			log.Printf("[RELOAD] reload failed; keeping current config: %s", err.Error())
+		}
+	}
+}
+
+func (s *poolService) poolHandler(c *gin.Context) {
+	// pin the current pool context for the lifetime of this request
+	c.Set("pool", s.pool())
+}
+
+func (s *poolService) handler(h func(*poolContext, *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pool, ok := c.Get("pool")
+		if ok == false {
+			pool = s.pool()
+		}
+
+		h(pool.(*poolContext), c)
+	}
+}
+
+func (s *poolService) reloadHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(s.pool(), c)
+	defer cl.cancel()
+
+	cl.logRequest()
+
+	res, err := s.reload()
+	if err != nil {
+		resp := searchResponse{status: http.StatusUnprocessableEntity, err: err}
+		if errors.Is(err, errReloadUnsupported) == true {
+			resp.status = http.StatusConflict
+		}
+
+		cl.logResponse(resp)
+		c.String(resp.status, resp.err.Error())
+		return
+	}
+
+	cl.logResponse(searchResponse{status: http.StatusOK})
+
+	c.JSON(http.StatusOK, res)
+}
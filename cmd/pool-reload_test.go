@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadKeepsCurrentPoolOnFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	malformed := filepath.Join(dir, "malformed.json")
+	if err := os.WriteFile(malformed, []byte(`{"global":`), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %s", err.Error())
+	}
+
+	tests := []struct {
+		name    string
+		cfgFile string
+		wantErr error
+	}{
+		{name: "environment", cfgFile: "", wantErr: errReloadUnsupported},
+		{name: "missing file", cfgFile: filepath.Join(dir, "missing.json")},
+		{name: "malformed file", cfgFile: malformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &poolContext{done: make(chan struct{})}
+
+			s := poolService{cfgFile: tt.cfgFile}
+			s.current.Store(pool)
+
+			_, err := s.reload()
+			if err == nil {
+				t.Fatalf("expected reload to fail")
+			}
+
+			if tt.wantErr != nil && errors.Is(err, tt.wantErr) == false {
+				t.Errorf("got error [%s], want [%s]", err.Error(), tt.wantErr.Error())
+			}
+
+			if s.pool() != pool {
+				t.Errorf("failed reload replaced the current pool context")
+			}
+
+			if pool.stopped() == true {
+				t.Errorf("failed reload stopped the current pool context")
+			}
+		})
+	}
+}
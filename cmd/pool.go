@@ -1,16 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
 	"net/http"
-	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/uvalib/virgo4-api/v4api"
@@ -30,11 +31,16 @@ type httpClientContext struct {
 	client  *http.Client
 	url     string
 	enabled bool
+	retry   retryPolicy
+	breaker *circuitBreaker
 }
 
 type poolSolr struct {
-	service              httpClientContext
-	healthCheck          httpClientContext
+	replicas             []*solrReplica
+	nextReplica          atomic.Uint64 // for round-robin replica selection
+	cache                *solrCache    // nil when disabled
+	schema               *solrSchema   // nil unless configured fields are checked against it
+	inflight             solrInflight  // identical in-flight requests
 	scoreThresholdMedium float32
 	scoreThresholdHigh   float32
 }
@@ -54,8 +60,9 @@ type poolMaps struct {
 }
 
 type filterInfo struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Match string `json:"match"`
 }
 type extendedIdentity struct {
 	v4api.PoolIdentity
@@ -76,6 +83,11 @@ type poolContext struct {
 	globalFacetCache     *facetCache // for pre-search filters
 	localFacetCache      *facetCache // for quick loading of facets on empty keyword searches
 	serialsSolutions     httpClientContext
+	requestBudget        time.Duration   // total time allowed per client request; 0 means unlimited
+	configHash           string          // identifies the configuration in use
+	problems             []configProblem // configuration problems found during initialization
+	validateOnly         bool            // initialized only to validate the configuration
+	done                 chan struct{}   // closed when this pool context is retired, stopping its background tasks
 }
 
 func (p *poolContext) initIdentity() {
@@ -110,7 +122,7 @@ func (p *poolContext) initIdentity() {
 	}
 
 	for _, f := range p.maps.supportedFilters {
-		p.identity.Filters = append(p.identity.Filters, filterInfo{ID: f.ID, Name: f.Name})
+		p.identity.Filters = append(p.identity.Filters, filterInfo{ID: f.ID, Name: f.Name, Match: f.Match})
 	}
 
 	log.Printf("[POOL] identity.Name             = [%s]", p.identity.Name)
@@ -119,7 +131,7 @@ func (p *poolContext) initIdentity() {
 	log.Printf("[POOL] supported filters         = [%s]", p.identity.Filters)
 }
 
-func (p *poolContext) initProviders() {
+func (p *poolContext) initProviders() error {
 	invalid := false
 
 	for _, val := range p.config.Global.Providers {
@@ -142,16 +154,17 @@ func (p *poolContext) initProviders() {
 		var err error
 
 		if provider.re, err = regexp.Compile(provider.Pattern); err != nil {
-			log.Printf("[INIT] pattern compilation error in provider entry %d (name: %s): %s", i, provider.Name, err.Error())
+			p.configProblem(&provider.Pattern, "[INIT] pattern compilation error in provider entry %d (name: %s): %s", i, provider.Name, err.Error())
 			invalid = true
 			continue
 		}
 	}
 
 	if invalid == true {
-		log.Printf("[INIT] exiting due to error(s) above")
-		os.Exit(1)
+		return errors.New("invalid provider configuration")
 	}
+
+	return nil
 }
 
 func (p *poolContext) initVersion() {
@@ -193,32 +206,60 @@ func httpClientWithTimeouts(conn, read string) *http.Client {
 }
 
 func (p *poolContext) initSolr() {
-	// service client setup
+	// client setup for each replica
 
-	serviceCtx := httpClientContext{
-		url:    fmt.Sprintf("%s/%s/%s", p.config.Local.Solr.Host, p.config.Local.Solr.Core, p.config.Local.Solr.Clients.Service.Endpoint),
-		client: httpClientWithTimeouts(p.config.Local.Solr.Clients.Service.ConnTimeout, p.config.Local.Solr.Clients.Service.ReadTimeout),
+	for _, host := range p.solrHosts() {
+		p.solr.replicas = append(p.solr.replicas, newSolrReplica(host, p.config.Local.Solr))
 	}
 
-	healthCtx := httpClientContext{
-		url:    fmt.Sprintf("%s/%s/%s", p.config.Local.Solr.Host, p.config.Local.Solr.Core, p.config.Local.Solr.Clients.HealthCheck.Endpoint),
-		client: httpClientWithTimeouts(p.config.Local.Solr.Clients.HealthCheck.ConnTimeout, p.config.Local.Solr.Clients.HealthCheck.ReadTimeout),
+	p.solr.cache = newSolrCache(integerWithMinimum(p.config.Local.Solr.Cache.Size, 0))
+
+	p.solr.scoreThresholdMedium = p.config.Local.Solr.ScoreThresholdMedium
+	p.solr.scoreThresholdHigh = p.config.Local.Solr.ScoreThresholdHigh
+
+	for i, r := range p.solr.replicas {
+		log.Printf("[POOL] solr.replica[%d].service.url     = [%s]", i, r.service.url)
+		log.Printf("[POOL] solr.replica[%d].healthCheck.url = [%s]", i, r.healthCheck.url)
 	}
 
-	p.solr = poolSolr{
-		service:              serviceCtx,
-		healthCheck:          healthCtx,
-		scoreThresholdMedium: p.config.Local.Solr.ScoreThresholdMedium,
-		scoreThresholdHigh:   p.config.Local.Solr.ScoreThresholdHigh,
+	if len(p.solr.replicas) > 0 {
+		r := p.solr.replicas[0]
+		log.Printf("[POOL] solr.service.retries      = [%d]", r.service.retry.maxRetries)
+		log.Printf("[POOL] solr.service.breaker      = [%d failures / %s]", r.breaker.threshold, r.breaker.openTimeout)
 	}
 
-	log.Printf("[POOL] solr.service.url          = [%s]", p.solr.service.url)
-	log.Printf("[POOL] solr.healthCheck.url      = [%s]", p.solr.healthCheck.url)
+	log.Printf("[POOL] solr.cache.size           = [%d]", p.solr.cache.stats().Size)
 	log.Printf("[POOL] solr.scoreThresholdMedium = [%0.1f]", p.solr.scoreThresholdMedium)
 	log.Printf("[POOL] solr.scoreThresholdHigh   = [%0.1f]", p.solr.scoreThresholdHigh)
 }
 
-func (p *poolContext) initCitationFormats() {
+func (p *poolContext) initSolrReplicaMonitor() {
+	// only needed when there is somewhere to fail over to
+	if len(p.solr.replicas) < 2 {
+		return
+	}
+
+	interval := integerWithMinimum(p.config.Local.Solr.ReplicaCheck.Interval, 5)
+	maxFailures := integerWithMinimum(p.config.Local.Solr.ReplicaCheck.MaxFailures, 1)
+
+	log.Printf("[POOL] solr.replicaCheck         = [every %ds; %d failures]", interval, maxFailures)
+
+	go p.monitorSolrReplicas(interval, maxFailures)
+}
+
+func (p *poolContext) initSolrCacheMonitor() {
+	if p.solr.cache == nil {
+		return
+	}
+
+	interval := integerWithMinimum(p.config.Local.Solr.Cache.VersionInterval, 10)
+
+	log.Printf("[POOL] solr.cache.versionCheck   = [every %ds]", interval)
+
+	go p.monitorSolrIndexVersion(interval)
+}
+
+func (p *poolContext) initCitationFormats() error {
 	invalid := false
 
 	for i := range p.config.Global.CitationFormats {
@@ -227,18 +268,18 @@ func (p *poolContext) initCitationFormats() {
 		var err error
 
 		if citationFormat.Format == "" {
-			log.Printf("[INIT] empty format in citation format entry %d", i)
+			p.configProblem(&citationFormat.Format, "[INIT] empty format in citation format entry %d", i)
 			invalid = true
 		}
 
 		if citationFormat.Pattern == "" {
-			log.Printf("[INIT] empty pattern in citation format entry %d (format: %s)", i, citationFormat.Format)
+			p.configProblem(&citationFormat.Pattern, "[INIT] empty pattern in citation format entry %d (format: %s)", i, citationFormat.Format)
 			invalid = true
 			continue
 		}
 
 		if citationFormat.re, err = regexp.Compile(citationFormat.Pattern); err != nil {
-			log.Printf("[INIT] pattern compilation error in citation format entry %d (format: %s): %s", i, citationFormat.Format, err.Error())
+			p.configProblem(&citationFormat.Pattern, "[INIT] pattern compilation error in citation format entry %d (format: %s): %s", i, citationFormat.Format, err.Error())
 			invalid = true
 			continue
 		}
@@ -250,149 +291,211 @@ func (p *poolContext) initCitationFormats() {
 		var err error
 
 		if publisher.Pattern == "" {
-			log.Printf("[INIT] empty pattern in publisher entry %d (id: %s)", i, publisher.ID)
+			p.configProblem(&publisher.Pattern, "[INIT] empty pattern in publisher entry %d (id: %s)", i, publisher.ID)
 			invalid = true
 			continue
 		}
 
 		if publisher.re, err = regexp.Compile(publisher.Pattern); err != nil {
-			log.Printf("[INIT] pattern compilation error in publisher entry %d (id: %s): %s", i, publisher.ID, err.Error())
+			p.configProblem(&publisher.Pattern, "[INIT] pattern compilation error in publisher entry %d (id: %s): %s", i, publisher.ID, err.Error())
 			invalid = true
 			continue
 		}
 	}
 
 	if invalid == true {
-		log.Printf("[INIT] exiting due to error(s) above")
-		os.Exit(1)
+		return errors.New("invalid citation format configuration")
 	}
+
+	return nil
 }
 
-func (p *poolContext) validateConfig() {
+func (p *poolContext) validateConfig() error {
 	// ensure the existence and validity of required variables/solr fields
 
 	var err error
 
 	invalid := false
 
-	var solrFields stringValidator
-	var miscValues stringValidator
+	solrFields := stringValidator{pool: p, schema: p.solr.schema}
+	miscValues := stringValidator{pool: p}
 
-	for _, attribute := range p.config.Local.Identity.Attributes {
+	for i, attribute := range p.config.Local.Identity.Attributes {
 		if sliceContainsString(p.config.Global.Attributes, attribute, true) == false {
-			log.Printf("[VALIDATE] attribute [%s] not found in global attribute list", attribute)
+			p.configProblem(&p.config.Local.Identity.Attributes[i], "[VALIDATE] attribute [%s] not found in global attribute list", attribute)
 			invalid = true
 		}
 	}
 
-	miscValues.requireValue(p.config.Global.Service.DefaultSort.ID, "default sort id")
-	miscValues.requireValue(p.config.Global.Service.DefaultSort.Order, "default sort order")
+	miscValues.requireValue(&p.config.Global.Service.DefaultSort.ID, "default sort id")
+	miscValues.requireValue(&p.config.Global.Service.DefaultSort.Order, "default sort order")
 
-	if p.config.Global.Service.DefaultSort.ID != "" && p.maps.definedSorts[p.config.Global.Service.DefaultSort.ID].ID == "" {
-		log.Printf("[VALIDATE] default sort xid not found in sort options list")
+	if p.config.Global.Service.DefaultSort.ID != "" && p.maps.definedSorts[p.config.Global.Service.DefaultSort.ID] == nil {
+		p.configProblem(&p.config.Global.Service.DefaultSort.ID, "[VALIDATE] default sort xid not found in sort options list")
 		invalid = true
 	}
 
 	if isValidSortOrder(p.config.Global.Service.DefaultSort.Order) == false {
-		log.Printf("[VALIDATE] default sort order not valid")
+		p.configProblem(&p.config.Global.Service.DefaultSort.Order, "[VALIDATE] default sort order not valid")
+		invalid = true
+	}
+
+	miscValues.requireValue(&p.config.Local.Identity.Mode, "pool mode")
+
+	if len(p.solrHosts()) == 0 {
+		p.configProblem(&p.config.Local.Solr, "[VALIDATE] missing solr host(s)")
 		invalid = true
 	}
 
-	miscValues.requireValue(p.config.Local.Identity.Mode, "pool mode")
+	if integerWithMinimum(p.config.Local.Solr.Cache.Size, 0) > 0 {
+		miscValues.requireValue(&p.config.Local.Solr.Cache.VersionEndpoint, "solr cache version endpoint")
+	}
+
+	for _, host := range p.solrHosts() {
+		if isValidURL(host) == false {
+			p.configProblem(&p.config.Local.Solr, "[VALIDATE] invalid solr host: [%s]", host)
+			invalid = true
+		}
+	}
 
-	miscValues.requireValue(p.config.Local.Solr.Host, "solr host")
-	miscValues.requireValue(p.config.Local.Solr.Core, "solr core")
-	miscValues.requireValue(p.config.Local.Solr.Clients.Service.Endpoint, "solr search endpoint")
-	miscValues.requireValue(p.config.Local.Solr.Clients.HealthCheck.Endpoint, "solr health check endpoint")
-	miscValues.requireValue(p.config.Local.Solr.Params.Qt, "solr param qt")
-	miscValues.requireValue(p.config.Local.Solr.Params.DefType, "solr param deftype")
+	miscValues.requireValue(&p.config.Local.Solr.Core, "solr core")
+	miscValues.requireValue(&p.config.Local.Solr.Clients.Service.Endpoint, "solr search endpoint")
+	miscValues.requireValue(&p.config.Local.Solr.Clients.HealthCheck.Endpoint, "solr health check endpoint")
+	miscValues.requireValue(&p.config.Local.Solr.Params.Qt, "solr param qt")
+	miscValues.requireValue(&p.config.Local.Solr.Params.DefType, "solr param deftype")
 
 	if len(p.config.Local.Solr.Params.Fq.Pool) == 0 {
-		log.Printf("[VALIDATE] solr param pool fq is empty")
+		p.configProblem(&p.config.Local.Solr.Params.Fq.Pool, "[VALIDATE] solr param pool fq is empty")
 		invalid = true
 	}
 
-	solrFields.requireValue(p.config.Local.Solr.GroupField, "solr grouping field")
-	solrFields.requireValue(p.config.Local.Solr.ExactMatchTitleField, "solr exact match title field")
-	solrFields.requireValue(p.config.Global.Availability.FieldConfig.FieldAnon, "anon availability field")
-	solrFields.requireValue(p.config.Global.Availability.FieldConfig.FieldAuth, "auth availability field")
+	solrFields.requireValue(&p.config.Local.Solr.GroupField, "solr grouping field")
+	solrFields.requireValue(&p.config.Local.Solr.ExactMatchTitleField, "solr exact match title field")
+	solrFields.requireValue(&p.config.Global.Availability.FieldConfig.FieldAnon, "anon availability field")
+	solrFields.requireValue(&p.config.Global.Availability.FieldConfig.FieldAuth, "auth availability field")
+
+	for i := range p.config.Local.Solr.MoreLikeThis.Fields {
+		solrFields.requireValue(&p.config.Local.Solr.MoreLikeThis.Fields[i], fmt.Sprintf("more like this field %d", i))
+	}
 
 	if p.config.Local.Identity.Mode == "image" {
 		if p.config.Local.Related == nil {
-			log.Printf("[VALIDATE] missing related section")
+			p.configProblem(&p.config.Local, "[VALIDATE] missing related section")
 			invalid = true
 		} else if p.config.Local.Related.Image == nil {
-			log.Printf("[VALIDATE] missing related image section")
+			p.configProblem(p.config.Local.Related, "[VALIDATE] missing related image section")
 			invalid = true
 		} else {
-			solrFields.requireValue(p.config.Local.Related.Image.IIIFManifestField, "iiif manifest field")
-			solrFields.requireValue(p.config.Local.Related.Image.IIIFImageField, "iiif image field")
+			solrFields.requireValue(&p.config.Local.Related.Image.IIIFManifestField, "iiif manifest field")
+			solrFields.requireValue(&p.config.Local.Related.Image.IIIFImageField, "iiif image field")
 		}
 	}
 
 	for i, val := range p.sorts {
-		solrFields.requireValue(val.Field, fmt.Sprintf("sort option %d group field", i))
+		solrFields.requireValue(&val.Field, fmt.Sprintf("sort option %d group field", i))
 
-		if val.RecordID != "" && p.maps.definedSorts[val.RecordID].ID == "" {
-			log.Printf("[VALIDATE] sort option %d record sort id not found in sort options list", i)
+		if val.RecordID != "" && p.maps.definedSorts[val.RecordID] == nil {
+			p.configProblem(&val.RecordID, "[VALIDATE] sort option %d record sort id not found in sort options list", i)
 			invalid = true
 		}
 
 		if val.Order != "" && isValidSortOrder(val.Order) == false {
-			log.Printf("[VALIDATE] sort option %d sort order invalid", i)
+			p.configProblem(&val.Order, "[VALIDATE] sort option %d sort order invalid", i)
 			invalid = true
 		}
 
 		if val.RecordOrder != "" && isValidSortOrder(val.RecordOrder) == false {
-			log.Printf("[VALIDATE] sort option %d record sort order invalid", i)
+			p.configProblem(&val.RecordOrder, "[VALIDATE] sort option %d record sort order invalid", i)
 			invalid = true
 		}
+
+		switch val.GroupStrategy {
+		case "", "queries":
+		case "expand":
+			if val.GroupRecordLimit < 1 {
+				p.configProblem(&val.GroupRecordLimit, "[VALIDATE] sort option %d group record limit must be at least 1 for expand strategy", i)
+				invalid = true
+			}
+		default:
+			p.configProblem(&val.GroupStrategy, "[VALIDATE] sort option %d group strategy invalid: [%s]", i, val.GroupStrategy)
+			invalid = true
+		}
+	}
+
+	if role := p.config.Global.Service.Export.MinimalRole; role != "" && v4jwt.RoleFromString(role).String() != role {
+		p.configProblem(&p.config.Global.Service.Export.MinimalRole, "[VALIDATE] export minimal role value [%s] appears invalid; see v4jwt module for valid values", role)
+		invalid = true
+	}
+
+	switch p.config.Global.Service.FilterGroupOperator {
+	case "", "OR", "AND":
+	default:
+		p.configProblem(&p.config.Global.Service.FilterGroupOperator, "[VALIDATE] filter group operator invalid: [%s]", p.config.Global.Service.FilterGroupOperator)
+		invalid = true
 	}
 
 	for xid, val := range p.maps.definedFilters {
 		if val.Solr.Type == "terms" {
-			solrFields.requireValue(val.Solr.Field, fmt.Sprintf("filter [%s] solr field", xid))
+			solrFields.requireValue(&val.Solr.Field, fmt.Sprintf("filter [%s] solr field", xid))
+		}
+
+		if val.Type == "hierarchy" {
+			solrFields.requireValue(&val.Solr.Field, fmt.Sprintf("filter [%s] solr field", xid))
+			solrFields.requireValue(&val.Hierarchy.ParentField, fmt.Sprintf("filter [%s] hierarchy parent field", xid))
 		}
 	}
 
-	for i, val := range p.config.Global.Publishers {
-		solrFields.requireValue(val.Field, fmt.Sprintf("publisher %d solr field", i))
+	for i := range p.config.Global.Publishers {
+		val := &p.config.Global.Publishers[i]
+
+		solrFields.requireValue(&val.Field, fmt.Sprintf("publisher %d solr field", i))
 	}
 
 	for i := range p.config.Global.Copyrights {
 		val := &p.config.Global.Copyrights[i]
 
-		solrFields.requireValue(val.Field, fmt.Sprintf("copyright %d solr field", i))
-		miscValues.requireValue(val.Pattern, fmt.Sprintf("copyright %d pattern", i))
+		solrFields.requireValue(&val.Field, fmt.Sprintf("copyright %d solr field", i))
+		miscValues.requireValue(&val.Pattern, fmt.Sprintf("copyright %d pattern", i))
 
 		if val.re, err = regexp.Compile(val.Pattern); err != nil {
-			log.Printf("[VALIDATE] pattern compilation error in copyright entry %d: %s", i, err.Error())
+			p.configProblem(&val.Pattern, "[VALIDATE] pattern compilation error in copyright entry %d: %s", i, err.Error())
 			invalid = true
 			continue
 		}
 	}
 
-	for k, v := range p.config.Global.Titleization.Exclusions.Comparisons {
-		solrFields.requireValue(v.Field, fmt.Sprintf("titleization comparison field %d solr field", k))
+	for k := range p.config.Global.Titleization.Exclusions.Comparisons {
+		v := &p.config.Global.Titleization.Exclusions.Comparisons[k]
+
+		solrFields.requireValue(&v.Field, fmt.Sprintf("titleization comparison field %d solr field", k))
 	}
 
-	solrFields.requireValue(p.config.Global.RecordAttributes.DigitalContent.Field, "record attribute: digital content feature field")
-	solrFields.requireValue(p.config.Global.RecordAttributes.Sirsi.Field, "record attribute: sirsi data source field")
-	solrFields.requireValue(p.config.Global.RecordAttributes.WSLS.Field, "record attribute: wsls data source field")
+	solrFields.requireValue(&p.config.Global.RecordAttributes.DigitalContent.Field, "record attribute: digital content feature field")
+	solrFields.requireValue(&p.config.Global.RecordAttributes.Sirsi.Field, "record attribute: sirsi data source field")
+	solrFields.requireValue(&p.config.Global.RecordAttributes.WSLS.Field, "record attribute: wsls data source field")
 
 	for i := range p.resourceTypeContexts {
 		r := p.resourceTypeContexts[i]
 
-		for _, val := range r.AuthorFields.Preferred {
-			solrFields.requireValue(val, fmt.Sprintf("resource type %d [%s] preferred author field", i, r.Value))
+		for k := range r.AuthorFields.Preferred {
+			solrFields.requireValue(&r.AuthorFields.Preferred[k], fmt.Sprintf("resource type %d [%s] preferred author field", i, r.Value))
 		}
-		for _, val := range r.AuthorFields.Fallback {
-			solrFields.requireValue(val, fmt.Sprintf("resource type %d [%s] fallback author field", i, r.Value))
+		for k := range r.AuthorFields.Fallback {
+			solrFields.requireValue(&r.AuthorFields.Fallback[k], fmt.Sprintf("resource type %d [%s] fallback author field", i, r.Value))
+		}
+
+		for j := range r.Suggestions {
+			val := &r.Suggestions[j]
+
+			miscValues.requireValue(&val.Field, fmt.Sprintf("resource type %d [%s] suggestion %d field", i, r.Value, j))
+			solrFields.requireValue(&val.Dictionary, fmt.Sprintf("resource type %d [%s] suggestion %d dictionary", i, r.Value, j))
 		}
 
 		for j, val := range r.filters {
-			for k, q := range val.ComponentQueries {
-				miscValues.requireValue(q.Query, fmt.Sprintf("resource type %d [%s] filter %d component query query %d", i, r.Value, j, k))
+			for k := range val.ComponentQueries {
+				q := &val.ComponentQueries[k]
+
+				miscValues.requireValue(&q.Query, fmt.Sprintf("resource type %d [%s] filter %d component query query %d", i, r.Value, j, k))
 			}
 		}
 
@@ -408,9 +511,13 @@ func (p *poolContext) validateConfig() {
 			solrFields.setPostfix(postfix)
 			miscValues.setPostfix(postfix)
 
+			// fields are copies of their definitions; report problems against the definition
+			solrFields.setContext(p.maps.definedFields[field.Name])
+			miscValues.setContext(p.maps.definedFields[field.Name])
+
 			// start validating
 
-			miscValues.requireValue(field.Name, "name")
+			miscValues.requireValue(&field.Name, "name")
 
 			// verify any defined minimal role name is actually valid, since it's a free-form string
 			if field.MinimalRole != "" {
@@ -419,7 +526,7 @@ func (p *poolContext) validateConfig() {
 
 				minimalRole := v4jwt.RoleFromString(field.MinimalRole)
 				if minimalRole.String() != field.MinimalRole {
-					log.Printf("[VALIDATE] %s%s section minimal role value [%s] appears invalid; see v4jwt module for valid values%s", prefix, field.Name, field.MinimalRole, postfix)
+					p.configProblem(p.maps.definedFields[field.Name], "[VALIDATE] %s%s section minimal role value [%s] appears invalid; see v4jwt module for valid values%s", prefix, field.Name, field.MinimalRole, postfix)
 					invalid = true
 				}
 			}
@@ -429,7 +536,7 @@ func (p *poolContext) validateConfig() {
 			if field.CustomConfig == nil {
 				// require a solr field to get values from, unless a value is explicitly defined
 				if field.Value == "" {
-					solrFields.requireValue(field.Field, "solr field")
+					solrFields.requireValue(&field.Field, "solr field")
 				}
 				continue
 			}
@@ -440,23 +547,25 @@ func (p *poolContext) validateConfig() {
 			case "abstract":
 				field.CustomConfig.handler = getCustomFieldAbstract
 
-				solrFields.requireValue(field.CustomConfig.AlternateField, fmt.Sprintf("%s section alternate field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.AlternateField, fmt.Sprintf("%s section alternate field", field.Name))
 
 			case "access_note":
 				field.CustomConfig.handler = getCustomFieldAccessNote
 
-				for k, f := range field.CustomConfig.Overrides {
-					for k2, f2 := range f.Conditions.Comparisons {
-						solrFields.requireValue(f2.Field, fmt.Sprintf("%s section override field %d condition field %d solr field", field.Name, k, k2))
+				for k := range field.CustomConfig.Overrides {
+					for k2 := range field.CustomConfig.Overrides[k].Conditions.Comparisons {
+						f2 := &field.CustomConfig.Overrides[k].Conditions.Comparisons[k2]
+
+						solrFields.requireValue(&f2.Field, fmt.Sprintf("%s section override field %d condition field %d solr field", field.Name, k, k2))
 					}
 				}
 
 			case "access_url":
 				field.CustomConfig.handler = getCustomFieldAccessURL
 
-				solrFields.requireValue(field.CustomConfig.URLField, fmt.Sprintf("%s section url field", field.Name))
-				solrFields.requireValue(field.CustomConfig.LabelField, fmt.Sprintf("%s section label field", field.Name))
-				solrFields.requireValue(field.CustomConfig.ProviderField, fmt.Sprintf("%s section provider field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.URLField, fmt.Sprintf("%s section url field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.LabelField, fmt.Sprintf("%s section label field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.ProviderField, fmt.Sprintf("%s section provider field", field.Name))
 				solrFields.addValue(field.CustomConfig.ISBNField)
 				solrFields.addValue(field.CustomConfig.ISSNField)
 
@@ -465,11 +574,11 @@ func (p *poolContext) validateConfig() {
 
 			case "author":
 				field.CustomConfig.handler = getCustomFieldAuthor
-				miscValues.requireValue(field.CustomConfig.AlternateType, fmt.Sprintf("%s section alternate type", field.Name))
+				miscValues.requireValue(&field.CustomConfig.AlternateType, fmt.Sprintf("%s section alternate type", field.Name))
 
 			case "author_vernacular":
 				field.CustomConfig.handler = getCustomFieldAuthorVernacular
-				miscValues.requireValue(field.CustomConfig.AlternateType, fmt.Sprintf("%s section alternate type", field.Name))
+				miscValues.requireValue(&field.CustomConfig.AlternateType, fmt.Sprintf("%s section alternate type", field.Name))
 
 			case "availability":
 				field.CustomConfig.handler = getCustomFieldAvailability
@@ -492,15 +601,19 @@ func (p *poolContext) validateConfig() {
 			case "citation_is_online_only":
 				field.CustomConfig.handler = getCustomFieldCitationIsOnlineOnly
 
-				for k, f := range field.CustomConfig.Conditions.Comparisons {
-					solrFields.requireValue(f.Field, fmt.Sprintf("%s section condition field %d solr field", field.Name, k))
+				for k := range field.CustomConfig.Conditions.Comparisons {
+					f := &field.CustomConfig.Conditions.Comparisons[k]
+
+					solrFields.requireValue(&f.Field, fmt.Sprintf("%s section condition field %d solr field", field.Name, k))
 				}
 
 			case "citation_is_virgo_url":
 				field.CustomConfig.handler = getCustomFieldCitationIsVirgoURL
 
-				for k, f := range field.CustomConfig.Conditions.Comparisons {
-					solrFields.requireValue(f.Field, fmt.Sprintf("%s section condition field %d solr field", field.Name, k))
+				for k := range field.CustomConfig.Conditions.Comparisons {
+					f := &field.CustomConfig.Conditions.Comparisons[k]
+
+					solrFields.requireValue(&f.Field, fmt.Sprintf("%s section condition field %d solr field", field.Name, k))
 				}
 
 			case "citation_subtitle":
@@ -515,7 +628,7 @@ func (p *poolContext) validateConfig() {
 			case "collection_context":
 				field.CustomConfig.handler = getCustomFieldCollectionContext
 
-				solrFields.requireValue(field.CustomConfig.AlternateField, fmt.Sprintf("%s section alternate field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.AlternateField, fmt.Sprintf("%s section alternate field", field.Name))
 
 			case "composer_performer":
 				field.CustomConfig.handler = getCustomFieldComposerPerformer
@@ -526,19 +639,19 @@ func (p *poolContext) validateConfig() {
 			case "cover_image_url":
 				field.CustomConfig.handler = getCustomFieldCoverImageURL
 
-				miscValues.requireValue(field.CustomConfig.MusicPool, "%s section music pool")
+				miscValues.requireValue(&field.CustomConfig.MusicPool, "%s section music pool")
 
-				solrFields.requireValue(field.CustomConfig.TitleField, fmt.Sprintf("%s section title field", field.Name))
-				solrFields.requireValue(field.CustomConfig.PoolField, fmt.Sprintf("%s section pool field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.TitleField, fmt.Sprintf("%s section title field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.PoolField, fmt.Sprintf("%s section pool field", field.Name))
 
 				solrFields.addValue(field.CustomConfig.ISBNField)
 				solrFields.addValue(field.CustomConfig.OCLCField)
 				solrFields.addValue(field.CustomConfig.LCCNField)
 				solrFields.addValue(field.CustomConfig.UPCField)
 
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.CoverImages.Host, "cover images template host")
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.CoverImages.Path, "cover images template path")
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.CoverImages.Pattern, "cover images template pattern")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.CoverImages.Host, "cover images template host")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.CoverImages.Path, "cover images template path")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.CoverImages.Pattern, "cover images template pattern")
 
 			case "creator":
 				field.CustomConfig.handler = getCustomFieldCreator
@@ -546,35 +659,37 @@ func (p *poolContext) validateConfig() {
 			case "digital_content_url":
 				field.CustomConfig.handler = getCustomFieldDigitalContentURL
 
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.DigitalContent.Host, "digital content template host")
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.DigitalContent.Path, "digital content template path")
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.DigitalContent.Pattern, "digital content template pattern")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.DigitalContent.Host, "digital content template host")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.DigitalContent.Path, "digital content template path")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.DigitalContent.Pattern, "digital content template pattern")
 
 			case "extent_of_digitization":
 				field.CustomConfig.handler = getCustomFieldExtentOfDigitization
 
-				solrFields.requireValue(field.CustomConfig.PoolField, fmt.Sprintf("%s section pool field", field.Name))
-				solrFields.requireValue(field.CustomConfig.CallNumberField, fmt.Sprintf("%s section call number field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.PoolField, fmt.Sprintf("%s section pool field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.CallNumberField, fmt.Sprintf("%s section call number field", field.Name))
 
 			case "language":
 				field.CustomConfig.handler = getCustomFieldLanguage
 
-				solrFields.requireValue(field.CustomConfig.AlternateField, fmt.Sprintf("%s section alternate field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.AlternateField, fmt.Sprintf("%s section alternate field", field.Name))
 
 			case "library_availability_note":
 				field.CustomConfig.handler = getCustomFieldLibraryAvailabilityNote
 
-				for k, f := range field.CustomConfig.Overrides {
-					for k2, f2 := range f.Conditions.Comparisons {
-						solrFields.requireValue(f2.Field, fmt.Sprintf("%s section override field %d condition field %d solr field", field.Name, k, k2))
+				for k := range field.CustomConfig.Overrides {
+					for k2 := range field.CustomConfig.Overrides[k].Conditions.Comparisons {
+						f2 := &field.CustomConfig.Overrides[k].Conditions.Comparisons[k2]
+
+						solrFields.requireValue(&f2.Field, fmt.Sprintf("%s section override field %d condition field %d solr field", field.Name, k, k2))
 					}
 				}
 
 			case "online_related":
 				field.CustomConfig.handler = getCustomFieldOnlineRelated
 
-				solrFields.requireValue(field.CustomConfig.URLField, fmt.Sprintf("%s section url field", field.Name))
-				solrFields.requireValue(field.CustomConfig.LabelField, fmt.Sprintf("%s section label field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.URLField, fmt.Sprintf("%s section url field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.LabelField, fmt.Sprintf("%s section label field", field.Name))
 
 			case "published_date":
 				field.CustomConfig.handler = getCustomFieldPublishedDate
@@ -585,13 +700,13 @@ func (p *poolContext) validateConfig() {
 			case "publisher_name":
 				field.CustomConfig.handler = getCustomFieldPublisherName
 
-				solrFields.requireValue(field.CustomConfig.AlternateField, fmt.Sprintf("%s section alternate field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.AlternateField, fmt.Sprintf("%s section alternate field", field.Name))
 
 			case "related_resources":
 				field.CustomConfig.handler = getCustomFieldRelatedResources
 
-				solrFields.requireValue(field.CustomConfig.URLField, fmt.Sprintf("%s section url field", field.Name))
-				solrFields.requireValue(field.CustomConfig.LabelField, fmt.Sprintf("%s section label field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.URLField, fmt.Sprintf("%s section url field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.LabelField, fmt.Sprintf("%s section label field", field.Name))
 
 			case "responsibility_statement":
 				field.CustomConfig.handler = getCustomFieldResponsibilityStatement
@@ -599,18 +714,18 @@ func (p *poolContext) validateConfig() {
 			case "shelf_browse_url":
 				field.CustomConfig.handler = getCustomFieldShelfBrowseURL
 
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.ShelfBrowse.Host, "shelf browse template host")
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.ShelfBrowse.Path, "shelf browse template path")
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.ShelfBrowse.Pattern, "shelf browse template pattern")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.ShelfBrowse.Host, "shelf browse template host")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.ShelfBrowse.Path, "shelf browse template path")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.ShelfBrowse.Pattern, "shelf browse template pattern")
 
 			case "sirsi_url":
 				field.CustomConfig.handler = getCustomFieldSirsiURL
 
-				miscValues.requireValue(field.CustomConfig.IDPrefix, fmt.Sprintf("%s section id prefix", field.Name))
+				miscValues.requireValue(&field.CustomConfig.IDPrefix, fmt.Sprintf("%s section id prefix", field.Name))
 
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.Sirsi.Host, "sirsi template host")
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.Sirsi.Path, "sirsi template path")
-				miscValues.requireValue(p.config.Global.Service.URLTemplates.Sirsi.Pattern, "sirsi template pattern")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.Sirsi.Host, "sirsi template host")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.Sirsi.Path, "sirsi template path")
+				miscValues.requireValue(&p.config.Global.Service.URLTemplates.Sirsi.Pattern, "sirsi template pattern")
 
 			case "subject_summary":
 				field.CustomConfig.handler = getCustomFieldSubjectSummary
@@ -624,41 +739,44 @@ func (p *poolContext) validateConfig() {
 			case "title_subtitle_edition":
 				field.CustomConfig.handler = getCustomFieldTitleSubtitleEdition
 
-				solrFields.requireValue(field.CustomConfig.TitleField, fmt.Sprintf("%s section title field", field.Name))
-				solrFields.requireValue(field.CustomConfig.SubtitleField, fmt.Sprintf("%s section subtitle field", field.Name))
-				solrFields.requireValue(field.CustomConfig.EditionField, fmt.Sprintf("%s section edition field", field.Name))
-				miscValues.requireValue(field.CustomConfig.AlternateType, fmt.Sprintf("%s section alternate type", field.Name))
+				solrFields.requireValue(&field.CustomConfig.TitleField, fmt.Sprintf("%s section title field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.SubtitleField, fmt.Sprintf("%s section subtitle field", field.Name))
+				solrFields.requireValue(&field.CustomConfig.EditionField, fmt.Sprintf("%s section edition field", field.Name))
+				miscValues.requireValue(&field.CustomConfig.AlternateType, fmt.Sprintf("%s section alternate type", field.Name))
 
 			case "title_vernacular":
 				field.CustomConfig.handler = getCustomFieldTitleVernacular
 
-				miscValues.requireValue(field.CustomConfig.AlternateType, fmt.Sprintf("%s section alternate type", field.Name))
+				miscValues.requireValue(&field.CustomConfig.AlternateType, fmt.Sprintf("%s section alternate type", field.Name))
 
 			case "wsls_collection_description":
 				field.CustomConfig.handler = getCustomFieldWSLSCollectionDescription
 
 			default:
-				log.Printf("[VALIDATE] field %d: unhandled custom field: [%s]", j, field.Name)
+				p.configProblem(p.maps.definedFields[field.Name], "[VALIDATE] field %d: unhandled custom field: [%s]", j, field.Name)
 				invalid = true
 				continue
 			}
 
 			if field.CustomConfig.handler == nil {
-				log.Printf("[VALIDATE] field %d: custom field missing handler: [%s]", j, field.Name)
+				p.configProblem(p.maps.definedFields[field.Name], "[VALIDATE] field %d: custom field missing handler: [%s]", j, field.Name)
 				invalid = true
 				continue
 			}
 		}
 	}
 
+	p.validateSolrFieldUsage(&solrFields)
+
 	// check if anything went wrong anywhere
 
 	if invalid || solrFields.Invalid() || miscValues.Invalid() {
-		log.Printf("[VALIDATE] exiting due to error(s) above")
-		os.Exit(1)
+		return errors.New("invalid configuration")
 	}
 
 	// log.Printf("[POOL] supported languages       = [%s]", strings.Join(langs, ", "))
+
+	return nil
 }
 
 func (p *poolContext) populateFieldList(r *poolConfigResourceTypeContext, required []string, optional []string) ([]poolConfigField, bool) {
@@ -673,7 +791,7 @@ func (p *poolContext) populateFieldList(r *poolConfigResourceTypeContext, requir
 
 	for i, fieldName := range fieldNames {
 		if fieldName == "" {
-			log.Printf("[FIELDLIST] empty field name")
+			p.configProblem(r, "[FIELDLIST] empty field name")
 			invalid = true
 			continue
 		}
@@ -685,7 +803,7 @@ func (p *poolContext) populateFieldList(r *poolConfigResourceTypeContext, requir
 		fieldDef := p.maps.definedFields[fieldName]
 
 		if fieldDef == nil {
-			log.Printf("[FIELDLIST] unrecognized field name: [%s]", fieldName)
+			p.configProblem(r, "[FIELDLIST] unrecognized field name: [%s]", fieldName)
 			invalid = true
 			continue
 		}
@@ -710,7 +828,7 @@ func (p *poolContext) populateFieldList(r *poolConfigResourceTypeContext, requir
 				fieldDef.Properties.CitationPart = r.FieldNames.AuthorVernacular.CitationPart
 
 			default:
-				log.Printf("[FIELDLIST] unrecognized required field name: [%s]", fieldName)
+				p.configProblem(r, "[FIELDLIST] unrecognized required field name: [%s]", fieldName)
 				invalid = true
 				continue
 			}
@@ -724,7 +842,7 @@ func (p *poolContext) populateFieldList(r *poolConfigResourceTypeContext, requir
 	return fields, invalid
 }
 
-func (p *poolContext) initSorts() {
+func (p *poolContext) initSorts() error {
 	invalid := false
 
 	// configure globally defined sorts, and map their XIDs to sort definitions.
@@ -734,7 +852,7 @@ func (p *poolContext) initSorts() {
 		def := &p.config.Global.Mappings.Definitions.Sorts[i]
 
 		if p.maps.definedSorts[def.ID] != nil {
-			log.Printf("[SORTS] duplicate sort id: [%s]", def.ID)
+			p.configProblem(def, "[SORTS] duplicate sort id: [%s]", def.ID)
 			invalid = true
 			continue
 		}
@@ -749,14 +867,14 @@ func (p *poolContext) initSorts() {
 
 	// create sort list based on defined sorts
 	seen := make(map[string]bool)
-	for _, xid := range p.config.Global.Mappings.Configured.SortIDs {
+	for i, xid := range p.config.Global.Mappings.Configured.SortIDs {
 		if seen[xid] == true {
 			continue
 		}
 
 		def := p.maps.definedSorts[xid]
 		if def == nil {
-			log.Printf("[SORTS] unrecognized sort xid: [%s]", xid)
+			p.configProblem(&p.config.Global.Mappings.Configured.SortIDs[i], "[SORTS] unrecognized sort xid: [%s]", xid)
 			invalid = true
 			continue
 		}
@@ -767,12 +885,13 @@ func (p *poolContext) initSorts() {
 	}
 
 	if invalid == true {
-		log.Printf("[SORTS] exiting due to error(s) above")
-		os.Exit(1)
+		return errors.New("invalid sort configuration")
 	}
+
+	return nil
 }
 
-func (p *poolContext) initFields() {
+func (p *poolContext) initFields() error {
 	invalid := false
 
 	// configure globally defined fields, and map their XIDs to field definitions.
@@ -782,7 +901,7 @@ func (p *poolContext) initFields() {
 		def := &p.config.Global.Mappings.Definitions.Fields[i]
 
 		if p.maps.definedFields[def.Name] != nil {
-			log.Printf("[FIELDS] duplicate field name: [%s]", def.Name)
+			p.configProblem(def, "[FIELDS] duplicate field name: [%s]", def.Name)
 			invalid = true
 			continue
 		}
@@ -791,12 +910,13 @@ func (p *poolContext) initFields() {
 	}
 
 	if invalid == true {
-		log.Printf("[FIELDS] exiting due to error(s) above")
-		os.Exit(1)
+		return errors.New("invalid field configuration")
 	}
+
+	return nil
 }
 
-func (p *poolContext) initFilters() {
+func (p *poolContext) initFilters() error {
 	invalid := false
 
 	// availability setup
@@ -822,7 +942,7 @@ func (p *poolContext) initFilters() {
 		def := &p.config.Global.Mappings.Definitions.Filters[i]
 
 		if p.maps.definedFilters[def.ID] != nil {
-			log.Printf("[FILTERS] duplicate filter id: [%s]", def.ID)
+			p.configProblem(def, "[FILTERS] duplicate filter id: [%s]", def.ID)
 			invalid = true
 			continue
 		}
@@ -837,6 +957,28 @@ func (p *poolContext) initFilters() {
 			def.ExposedValues = p.config.Global.Availability.FilterConfig.ExposedValues.Combined
 		}
 
+		// records must match any (or all) of the selected values of a filter
+		switch def.Match {
+		case "":
+			def.Match = "any"
+
+		case "any", "all":
+
+		default:
+			p.configProblem(&def.Match, "[FILTERS] filter [%s] has invalid match mode: [%s]", def.ID, def.Match)
+			invalid = true
+			continue
+		}
+
+		// for range facets, validate bucket configuration
+		if def.Type == "range" {
+			if err := def.initRange(); err != nil {
+				p.configProblem(&def.Range, "[FILTERS] invalid range filter [%s]: %s", def.ID, err.Error())
+				invalid = true
+				continue
+			}
+		}
+
 		// for component query facets, create mappings from any
 		// possible translated value back to the query definition
 		if len(def.ComponentQueries) > 0 {
@@ -855,14 +997,14 @@ func (p *poolContext) initFilters() {
 
 	// create pre-search filter map based on configured pre-search filters
 	p.maps.preSearchFilters = make(map[string]*poolConfigFilter)
-	for _, id := range p.config.Global.Mappings.Configured.FilterIDs {
+	for i, id := range p.config.Global.Mappings.Configured.FilterIDs {
 		if p.maps.preSearchFilters[id] != nil {
 			continue
 		}
 
 		orig := p.maps.definedFilters[id]
 		if orig == nil {
-			log.Printf("[FILTERS] unrecognized filter id: [%s]", id)
+			p.configProblem(&p.config.Global.Mappings.Configured.FilterIDs[i], "[FILTERS] unrecognized filter id: [%s]", id)
 			invalid = true
 			continue
 		}
@@ -879,12 +1021,13 @@ func (p *poolContext) initFilters() {
 	}
 
 	if invalid == true {
-		log.Printf("[FILTERS] exiting due to error(s) above")
-		os.Exit(1)
+		return errors.New("invalid filter configuration")
 	}
+
+	return nil
 }
 
-func (p *poolContext) initResourceTypes() {
+func (p *poolContext) initResourceTypes() error {
 	invalid := false
 
 	// configure globally defined resource types, and map their XIDs to resource type definitions.
@@ -894,7 +1037,7 @@ func (p *poolContext) initResourceTypes() {
 		def := &p.config.Global.ResourceTypes.Contexts[i]
 
 		if p.maps.resourceTypeContexts[def.Value] != nil {
-			log.Printf("[RESTYPES] duplicate resource type value: [%s]", def.Value)
+			p.configProblem(def, "[RESTYPES] duplicate resource type value: [%s]", def.Value)
 			invalid = true
 			continue
 		}
@@ -906,12 +1049,25 @@ func (p *poolContext) initResourceTypes() {
 		p.resourceTypeContexts = append(p.resourceTypeContexts, def)
 	}
 
+	switch p.config.Global.ResourceTypes.CombinedFilters {
+	case "", "union", "intersection":
+	default:
+		p.configProblem(&p.config.Global.ResourceTypes.CombinedFilters, "[RESTYPES] invalid combined filters mode: [%s]", p.config.Global.ResourceTypes.CombinedFilters)
+		invalid = true
+	}
+
 	// build the list of supported filters, which is the union of supported pre-search filters
 	// and the filters for any of the supported resource types
 
 	poolFilterIDs := p.config.Global.Mappings.Configured.FilterIDs
-	for _, val := range p.config.Global.ResourceTypes.SupportedContexts {
+	for i, val := range p.config.Global.ResourceTypes.SupportedContexts {
 		ctx := p.maps.resourceTypeContexts[val]
+		if ctx == nil {
+			p.configProblem(&p.config.Global.ResourceTypes.SupportedContexts[i], "[RESTYPES] unrecognized supported context: [%s]", val)
+			invalid = true
+			continue
+		}
+
 		poolFilterIDs = append(poolFilterIDs, ctx.AdditionalFilterIDs...)
 	}
 
@@ -923,7 +1079,7 @@ func (p *poolContext) initResourceTypes() {
 
 		orig := p.maps.definedFilters[xid]
 		if orig == nil {
-			log.Printf("[RESTYPES] unrecognized filter xid: [%s]", xid)
+			p.configProblem(nil, "[RESTYPES] unrecognized filter xid: [%s]", xid)
 			invalid = true
 			continue
 		}
@@ -971,7 +1127,7 @@ func (p *poolContext) initResourceTypes() {
 
 			orig := p.maps.definedFilters[id]
 			if orig == nil {
-				log.Printf("[RESTYPES] resource type value [%s] contains unrecognized filter xid: [%s]", r.Value, id)
+				p.configProblem(r, "[RESTYPES] resource type value [%s] contains unrecognized filter xid: [%s]", r.Value, id)
 				invalid = true
 				continue
 			}
@@ -1044,12 +1200,105 @@ func (p *poolContext) initResourceTypes() {
 	}
 
 	if invalid == true {
-		log.Printf("[RESTYPES] exiting due to error(s) above")
-		os.Exit(1)
+		return errors.New("invalid resource type configuration")
 	}
+
+	return nil
+}
+
+func (r *poolConfigResourceTypeContext) returnsFacet(id string) bool {
+	// whether this filter is returned as a facet; all of its filters can be applied regardless
+	return r.facetIDs == nil || r.facetIDs[id] == true
 }
 
-func (p *poolContext) initRelators() {
+func (p *poolContext) combinedResourceTypeContext(contexts []*poolConfigResourceTypeContext) *poolConfigResourceTypeContext {
+	// builds a resource type context for searches spanning several resource types.
+	// its filters are the union of theirs, in the order they are first listed, so that
+	// any of them can be applied; only the facets returned may be their intersection.
+	// anything else, including filter overrides, comes from the first resource type
+	// that defines it.
+
+	first := contexts[0]
+
+	combined := &poolConfigResourceTypeContext{
+		AuthorFields:    first.AuthorFields,
+		FieldNames:      first.FieldNames,
+		FilterOverrides: make(map[string]poolConfigFilterOverride),
+		filterMap:       make(map[string]*poolConfigFilter),
+		fields:          first.fields,
+	}
+
+	var values, labels []string
+
+	counts := make(map[string]int)
+	suggestions := make(map[string]bool)
+
+	for _, r := range contexts {
+		values = append(values, r.Value)
+		labels = append(labels, r.Label)
+
+		for _, id := range r.filterIDs {
+			counts[id]++
+		}
+
+		for id, override := range r.FilterOverrides {
+			if _, ok := combined.FilterOverrides[id]; ok == false {
+				combined.FilterOverrides[id] = override
+			}
+		}
+
+		for _, suggestion := range r.Suggestions {
+			if suggestions[suggestion.Field] == false {
+				combined.Suggestions = append(combined.Suggestions, suggestion)
+				suggestions[suggestion.Field] = true
+			}
+		}
+	}
+
+	combined.Value = strings.Join(values, "|")
+	combined.Label = strings.Join(labels, "|")
+
+	intersection := p.config.Global.ResourceTypes.CombinedFilters == "intersection"
+	if intersection == true {
+		combined.facetIDs = make(map[string]bool)
+	}
+
+	added := make(map[string]bool)
+
+	for _, r := range contexts {
+		for i := range r.filters {
+			id := r.filters[i].ID
+
+			if added[id] == true {
+				continue
+			}
+
+			added[id] = true
+
+			if intersection == true && counts[id] == len(contexts) {
+				combined.facetIDs[id] = true
+			}
+
+			// create a copy of the definition to avoid index confusion
+			def := r.filters[i]
+
+			// this is used to preserve facet order when building facets response
+			def.Index = len(combined.filters)
+
+			combined.filters = append(combined.filters, def)
+			combined.filterIDs = append(combined.filterIDs, id)
+		}
+	}
+
+	// map after building the list, since appending may move its elements
+	for i := range combined.filters {
+		combined.filterMap[combined.filters[i].ID] = &combined.filters[i]
+	}
+
+	return combined
+}
+
+func (p *poolContext) initRelators() error {
 	invalid := false
 
 	// relator maps
@@ -1060,7 +1309,7 @@ func (p *poolContext) initRelators() {
 		r := &p.config.Global.Relators.Map[i]
 
 		if r.Code == "" || len(r.Terms) == 0 {
-			log.Printf("[RELATORS] incomplete relator definition: code = [%s]  terms = [%v]", r.Code, r.Terms)
+			p.configProblem(r, "[RELATORS] incomplete relator definition: code = [%s]  terms = [%v]", r.Code, r.Terms)
 			invalid = true
 			continue
 		}
@@ -1072,9 +1321,10 @@ func (p *poolContext) initRelators() {
 	}
 
 	if invalid == true {
-		log.Printf("[RELATORS] exiting due to error(s) above")
-		os.Exit(1)
+		return errors.New("invalid relator configuration")
 	}
+
+	return nil
 }
 
 func (p *poolContext) initTitleizer() {
@@ -1093,17 +1343,46 @@ func (p *poolContext) initTitleizer() {
 }
 
 func (p *poolContext) initFacetCaches() {
+	cfg := p.config.Global.Service.FacetCache
+
+	globalDelay := integerWithMinimum(cfg.GlobalStartupDelay, 0)
+
+	localDelay := 30
+	if cfg.LocalStartupDelay != "" {
+		localDelay = integerWithMinimum(cfg.LocalStartupDelay, 0)
+	}
+
+	interval := 10 * 60
+	if cfg.RefreshInterval != "" {
+		interval = integerWithMinimum(cfg.RefreshInterval, 10)
+	}
+
+	log.Printf("[POOL] facetCache.global         = [delay %ds; every %ds]", globalDelay, interval)
+	log.Printf("[POOL] facetCache.local          = [delay %ds; every %ds]", localDelay, interval)
+
 	// start global facet cache
-	p.globalFacetCache = newFacetCache(p, 0, 10*60, true)
+	p.globalFacetCache = newFacetCache(p, globalDelay, interval, true)
 
 	// start local facet cache
-	p.localFacetCache = newFacetCache(p, 30, 10*60, false)
+	p.localFacetCache = newFacetCache(p, localDelay, interval, false)
 }
 
-func initializePool(cfg *poolConfig) *poolContext {
+func initializePool(cfg *poolConfig) (*poolContext, error) {
+	// builds and validates a pool context; its background tasks are not started until start() is called
+
 	p := poolContext{}
 
+	if err := p.init(cfg); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (p *poolContext) init(cfg *poolConfig) error {
 	p.config = cfg
+	p.done = make(chan struct{})
+	p.configHash = cfg.hash()
 	p.randomSource = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	p.serialsSolutions = httpClientContext{
@@ -1112,31 +1391,88 @@ func initializePool(cfg *poolConfig) *poolContext {
 		enabled: p.config.Global.Service.SerialsSolutions.Enabled,
 	}
 
-	// order is important, as some depend on others having been initialized already
+	p.requestBudget = time.Duration(integerWithMinimum(p.config.Global.Service.RequestBudget, 0)) * time.Millisecond
+
+	log.Printf("[POOL] service.requestBudget     = [%s]", p.requestBudget)
 
-	// no dependencies:
-	p.initVersion()
-	p.initSolr()
-	p.initRelators()
-	p.initProviders()
-	p.initTitleizer()
-	p.initCitationFormats()
-	p.initSorts()
-	p.initFields()
+	// order is important, as some depend on others having been initialized already.
+	// when only validating, every step is run even if an earlier one fails, so that all
+	// problems are reported at once; otherwise, initialization stops at the first failure.
 
-	// depends on: translations
-	p.initFilters()
+	steps := []func() error{
+		// no dependencies:
+		func() error { p.initVersion(); return nil },
+		func() error { p.initSolr(); return nil },
+		p.initRelators,
+		p.initProviders,
+		func() error { p.initTitleizer(); return nil },
+		p.initCitationFormats,
+		p.initSorts,
+		p.initFields,
 
-	// depends on: translations, filters
-	p.initResourceTypes()
+		// depends on: translations
+		p.initFilters,
 
-	// depends on: sorts
-	p.initIdentity()
+		// depends on: translations, filters
+		p.initResourceTypes,
+
+		// depends on: sorts
+		func() error { p.initIdentity(); return nil },
+
+		// depends on: solr
+		p.initSolrSchema,
+
+		p.validateConfig,
+	}
 
-	p.validateConfig()
+	var errs []error
+
+	for _, step := range steps {
+		if err := step(); err != nil {
+			errs = append(errs, err)
+
+			if p.validateOnly == false {
+				break
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *poolContext) start() {
+	// start solr replica monitor
+	p.initSolrReplicaMonitor()
+
+	// start solr index version monitor
+	p.initSolrCacheMonitor()
 
 	// start facet caches
 	p.initFacetCaches()
+}
+
+func (p *poolContext) stop() {
+	close(p.done)
+}
 
-	return &p
+func (p *poolContext) stopped() bool {
+	// whether this pool context has been retired
+
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *poolContext) wait(seconds int) bool {
+	// sleeps for the given time, returning false early if this pool context has been retired
+
+	select {
+	case <-p.done:
+		return false
+	case <-time.After(time.Duration(seconds) * time.Second):
+		return true
+	}
 }
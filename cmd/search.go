@@ -2,14 +2,13 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"slices"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -18,10 +17,12 @@ import (
 
 type virgoFlags struct {
 	groupResults     bool
+	expandGroups     bool
+	spellcheck       bool
 	requestFacets    bool
-	selectedFacets   bool
 	facetCache       bool
 	globalFacetCache bool
+	bypassFacetCache bool // facets must come from solr, e.g. when populating the facet cache
 	firstRecordOnly  bool
 	includeSnippets  bool
 	includeVisible   bool
@@ -35,13 +36,15 @@ type virgoDialog struct {
 	recordRes      *v4api.Record
 	solrQuery      string          // holds the solr query (either parsed or specified)
 	parserInfo     *solrParserInfo // holds the information for parsed queries
+	cursorMark     string          // for deep paging through all results
+	facetPage      *facetPage      // for paging through the values of a single facet
+	filterQueries  []string        // additional solr filter queries for internal searches
 	skipQuery      bool            // should we skip Solr communcation and just return empty results?
 	flags          virgoFlags
 	endpoint       string
 	body           string
-	currentFacet   string // which facet to consider when iterating over facets to build response
-	totalFilters   int    // number of (valid) filters in the request
-	invalidFilters bool   // whether the request contains an unsupported filter
+	totalFilters   int  // number of (valid) filters in the request
+	invalidFilters bool // whether the request contains an unsupported filter
 }
 
 type solrDialog struct {
@@ -52,6 +55,7 @@ type solrDialog struct {
 type searchContext struct {
 	pool            *poolContext
 	client          *clientContext
+	ctx             context.Context // all external requests are made within this context
 	virgo           virgoDialog
 	solr            solrDialog
 	resourceTypeCtx *poolConfigResourceTypeContext
@@ -78,6 +82,7 @@ func confidenceIndex(s string) int {
 func (s *searchContext) init(p *poolContext, c *clientContext) {
 	s.pool = p
 	s.client = c
+	s.ctx = c.ctx
 	s.virgo.flags.groupResults = true
 	s.virgo.flags.includeVisible = true
 	s.virgo.flags.includeHidden = false
@@ -98,10 +103,13 @@ func (s *searchContext) copySearchContext() *searchContext {
 	c := *s.client
 	sc.client = &c
 
+	sc.ctx = s.ctx
+
 	v := s.virgo.req
 	sc.virgo.req = v
 
 	sc.virgo.endpoint = s.virgo.endpoint
+	sc.virgo.filterQueries = s.virgo.filterQueries
 	sc.virgo.flags = s.virgo.flags
 
 	sc.resourceTypeCtx = s.resourceTypeCtx
@@ -109,6 +117,17 @@ func (s *searchContext) copySearchContext() *searchContext {
 	return sc
 }
 
+func (s *searchContext) requestAbandoned() error {
+	// returns an error if the client has gone away or the request budget has been used up,
+	// in which case no further external requests should be made
+
+	if err := s.ctx.Err(); err != nil {
+		return contextStatusError(err)
+	}
+
+	return nil
+}
+
 func (s *searchContext) log(format string, args ...interface{}) {
 	s.client.log(format, args...)
 }
@@ -139,7 +158,7 @@ func (s *searchContext) performQuery() searchResponse {
 
 	if err != nil {
 		s.err("query execution error: %s", err.Error())
-		return searchResponse{status: http.StatusInternalServerError, err: err}
+		return searchResponse{status: statusFromError(err, http.StatusInternalServerError), err: err}
 	}
 
 	return searchResponse{status: http.StatusOK}
@@ -262,22 +281,13 @@ func (s *searchContext) newSearchWithRecordCountOnly() (*searchContext, error) {
 }
 
 func (s *searchContext) newSearchWithRecordListForGroups(initialQuery string, groups []string) (*searchContext, error) {
-	// NOTE: groups passed in are quoted strings
-
 	c := s.copySearchContext()
 
 	// just want records
 	c.virgo.flags.groupResults = false
 
-	// wrap groups for safer querying
-	var safeGroups []string
-
-	for _, group := range groups {
-		safeGroups = append(safeGroups, strconv.Quote(group))
-	}
-
 	// build group-restricted query from initial query
-	groupClause := fmt.Sprintf(`%s:(%s)`, s.pool.config.Local.Solr.GroupField, strings.Join(safeGroups, " OR "))
+	groupClause := solrFieldPhrases(s.pool.config.Local.Solr.GroupField, groups)
 
 	// prepend existing query, if defined
 	newQuery := groupClause
@@ -291,6 +301,16 @@ func (s *searchContext) newSearchWithRecordListForGroups(initialQuery string, gr
 	// get "everything"
 	c.virgo.req.Pagination = v4api.Pagination{Start: 0, Rows: 100000}
 
+	c.virgo.req.Sort = s.intraGroupSort()
+
+	if resp := c.getPoolQueryResults(); resp.err != nil {
+		return nil, resp.err
+	}
+
+	return c, nil
+}
+
+func (s *searchContext) intraGroupSort() v4api.SortOrder {
 	// intra-group sorting:
 	// * inherit sort from original search;
 	// * if that sort xid's definition specifies a record sort xid:
@@ -310,13 +330,7 @@ func (s *searchContext) newSearchWithRecordListForGroups(initialQuery string, gr
 
 	//s.log("SORT: intra-group sort: %#v", sortOpt)
 
-	c.virgo.req.Sort = sortOpt
-
-	if resp := c.getPoolQueryResults(); resp.err != nil {
-		return nil, resp.err
-	}
-
-	return c, nil
+	return sortOpt
 }
 
 func (s *searchContext) newSearchWithHighlightedSnippetsForIDs(initialQuery string, ids []string) (*searchContext, error) {
@@ -325,15 +339,8 @@ func (s *searchContext) newSearchWithHighlightedSnippetsForIDs(initialQuery stri
 	// just want records
 	c.virgo.flags.groupResults = false
 
-	// wrap ids for safer querying
-	var safeIDs []string
-
-	for _, id := range ids {
-		safeIDs = append(safeIDs, strconv.Quote(id))
-	}
-
 	// build id-restricted query from initial query
-	idClause := fmt.Sprintf(`%s:(%s)`, s.pool.config.Local.Solr.IdentifierField, strings.Join(safeIDs, " OR "))
+	idClause := solrFieldPhrases(s.pool.config.Local.Solr.IdentifierField, ids)
 
 	// prepend existing query, if defined
 	newQuery := idClause
@@ -392,6 +399,12 @@ func (s *searchContext) populateGroups() error {
 		return nil
 	}
 
+	// expanded results already contain everything we need
+	if s.virgo.flags.expandGroups == true {
+		s.populateExpandedGroups()
+		return nil
+	}
+
 	/*
 		// image pool only presents first result in UI, but we still want counts.
 		// set up to query solr for counts but don't waste time populating anything
@@ -457,6 +470,46 @@ func (s *searchContext) populateGroups() error {
 	return nil
 }
 
+func (s *searchContext) populateExpandedGroups() {
+	// each record in the initial record list is the head of its group, and the
+	// remaining records (up to the configured limit) were returned alongside it
+
+	// records are matched to their solr documents by position
+	if len(s.virgo.poolRes.Groups[0].Records) != len(s.solr.res.Response.Docs) {
+		s.warn("expected %d records but found %d; not expanding groups", len(s.solr.res.Response.Docs), len(s.virgo.poolRes.Groups[0].Records))
+		s.wrapRecordsInGroups()
+		return
+	}
+
+	var groups []v4api.Group
+
+	for i := range s.solr.res.Response.Docs {
+		groupRecord := &s.solr.res.Response.Docs[i]
+		groupValue := s.getSolrGroupFieldValue(groupRecord)
+
+		expanded := s.solr.res.Expanded[groupValue]
+
+		records := []v4api.Record{s.virgo.poolRes.Groups[0].Records[i]}
+		records = append(records, s.populateRecords(&expanded)...)
+
+		// count reflects the entire group, not just the records returned
+		groups = append(groups, v4api.Group{Value: groupValue, Count: expanded.NumFound + 1, Records: records})
+	}
+
+	s.virgo.poolRes.Groups = groups
+
+	// finally replace group counts with record counts, if they were returned
+
+	recordCount, ok := s.solr.res.Facets[groupRecordCountFacet]
+	if ok == false {
+		s.warn("no record count returned; reporting document count instead")
+		s.virgo.poolRes.Pagination.Total = s.solr.res.Response.NumFound
+		return
+	}
+
+	s.virgo.poolRes.Pagination.Total = recordCount.Count
+}
+
 func (s *searchContext) augmentGroupedRecordsWithHighlightedSnippets() error {
 	// only if requested by client
 	if s.client.opts.snippets == false {
@@ -503,8 +556,14 @@ func (s *searchContext) augmentGroupedRecordsWithHighlightedSnippets() error {
 	var clauses []string
 
 	for _, fulltext := range s.virgo.parserInfo.fulltexts {
+		// parsed values are escaped for a different context; recover the original value
+		value, err := unescapeParserValue(fulltext)
+		if err != nil {
+			return fmt.Errorf("invalid fulltext value: %s", err.Error())
+		}
+
 		for _, field := range s.pool.config.Local.Solr.Highlighting.Fl {
-			clauses = append(clauses, fmt.Sprintf(`%s:"%s"`, field, fulltext))
+			clauses = append(clauses, solrFieldPhrase(field, value))
 		}
 	}
 
@@ -573,56 +632,148 @@ func (s *searchContext) validateSearchRequest() error {
 		return resp.err
 	}
 
-	// ensure we received either zero or one filter group,
-	// and that any filters provided are supported
+	// ensure that any filters provided are supported
 
 	// NOTE: we also set the search-level resource type context here.
 	// this primarily controls what facets (if any) are included in the response.
-	// if the request contains a single "resource type" facet, we can use that
-	// resource type's defined facet list; otherwise we fall back to a default list.
+	// if the request selects "resource type" facet values (in any number of filter
+	// groups), we can use those resource types' defined facet lists; otherwise we
+	// fall back to a default list.
 
-	numFilterGroups := len(s.virgo.req.Filters)
+	s.log("VALIDATE: using resource type context [%s] by default", s.resourceTypeCtx.Value)
 
-	switch {
-	case numFilterGroups > 1:
-		return errors.New("received too many filter groups")
-
-	case numFilterGroups == 1:
-		// the pool id in the filter group is not associated with anything
-		// in our config, so the best we can do is ensure just one filter
-		// group was passed, and that it contains filters that we know about
-
-		s.log("VALIDATE: using resource type context [%s] by default", s.resourceTypeCtx.Value)
-
-		// first pass: determine resource type context
-		for _, filter := range s.virgo.req.Filters[0].Facets {
-			if filter.FacetID == "pool_f" {
-				pool := s.getInternalSolrValue("pool_f", filter.Value)
-				s.resourceTypeCtx = s.pool.maps.resourceTypeContexts[pool]
-				s.log("VALIDATE: using resource type context [%s] based on selected facets", s.resourceTypeCtx.Value)
+	if len(s.virgo.req.Filters) == 0 {
+		return nil
+	}
+
+	// first pass: determine resource type context
+
+	var contexts []*poolConfigResourceTypeContext
+
+	seen := make(map[*poolConfigResourceTypeContext]bool)
+
+	for _, filterGroup := range s.virgo.req.Filters {
+		for _, filter := range filterGroup.Facets {
+			// excluding a resource type does not select one
+			value, excluded := excludedFilterValue(filter.Value)
+			if excluded == true {
+				continue
 			}
+
+			if filter.FacetID != "pool_f" {
+				continue
+			}
+
+			ctx := s.pool.maps.resourceTypeContexts[s.getInternalSolrValue("pool_f", value)]
+			if ctx == nil || seen[ctx] == true {
+				continue
+			}
+
+			contexts = append(contexts, ctx)
+			seen[ctx] = true
 		}
+	}
 
-		// second pass: ensure filter(s) are present in the resource type context facet list
+	switch {
+	case len(contexts) == 1:
+		s.resourceTypeCtx = contexts[0]
+		s.log("VALIDATE: using resource type context [%s] based on selected facets", s.resourceTypeCtx.Value)
 
-		s.virgo.invalidFilters = false
-		s.virgo.totalFilters = 0
-		for _, filter := range s.virgo.req.Filters[0].Facets {
-			if _, rok := s.resourceTypeCtx.filterMap[filter.FacetID]; rok == false {
+	case len(contexts) > 1:
+		s.resourceTypeCtx = s.pool.combinedResourceTypeContext(contexts)
+		s.log("VALIDATE: using combined resource type context [%s] based on selected facets", s.resourceTypeCtx.Value)
+	}
+
+	// second pass: ensure filter(s) are present in the resource type context facet list.
+	// a group containing an unsupported filter cannot match anything; when groups are OR'd,
+	// such groups are dropped, and the request only matches nothing if every group does.
+
+	s.virgo.invalidFilters = false
+	s.virgo.totalFilters = 0
+
+	var validGroups []v4api.Filter
+
+	for _, filterGroup := range s.virgo.req.Filters {
+		invalidGroup := false
+
+		for _, filter := range filterGroup.Facets {
+			filterDef, rok := s.resourceTypeCtx.filterMap[filter.FacetID]
+			if rok == false {
 				s.log("VALIDATE: received known filter [%s] that is not present in resource type context [%s]", filter.FacetID, s.resourceTypeCtx.Value)
-				s.virgo.invalidFilters = true
-			} else {
-				s.virgo.totalFilters++
+				invalidGroup = true
+				continue
+			}
+
+			if err := validateFilterValueMarker(filter.Value); err != nil {
+				return fmt.Errorf("invalid value for filter [%s]: %s", filter.FacetID, err.Error())
 			}
+
+			value, excluded := excludedFilterValue(filter.Value)
+
+			// ensure filter values are something we can query
+			switch filterDef.Type {
+			case "boolean":
+				// values are mapped to configured values, which are either selected or not
+				if excluded == true {
+					return fmt.Errorf("invalid value for filter [%s]: boolean filters cannot be excluded", filter.FacetID)
+				}
+
+			case "component":
+				// values are mapped to configured values
+
+			case "range":
+				if _, _, err := solrRangeFilter(filterDef.Solr.Field, filterDef.Range.ValueType, value); err != nil {
+					return fmt.Errorf("invalid value for filter [%s]: %s", filter.FacetID, err.Error())
+				}
+
+			default:
+				// values are passed on to solr
+				if err := validateSolrValue("filter value", value); err != nil {
+					return fmt.Errorf("invalid value for filter [%s]: %s", filter.FacetID, err.Error())
+				}
+			}
+
+			s.virgo.totalFilters++
 		}
 
-	default:
-		s.log("VALIDATE: using resource type context [%s] by default", s.resourceTypeCtx.Value)
+		if invalidGroup == true {
+			s.virgo.invalidFilters = true
+			continue
+		}
+
+		validGroups = append(validGroups, filterGroup)
+	}
+
+	if s.virgo.invalidFilters == true && len(s.virgo.req.Filters) > 1 && s.pool.config.Global.Service.FilterGroupOperator != "AND" && len(validGroups) > 0 {
+		s.log("VALIDATE: dropping %d filter group(s) containing unsupported filters", len(s.virgo.req.Filters)-len(validGroups))
+		s.virgo.req.Filters = validGroups
+		s.virgo.invalidFilters = false
 	}
 
 	return nil
 }
 
+func (s *searchContext) isSingleResourceTypeSelection() bool {
+	// whether the request filters on exactly one resource type, and nothing else
+
+	if s.virgo.totalFilters != 1 || len(s.virgo.req.Filters) != 1 || len(s.virgo.req.Filters[0].Facets) != 1 {
+		return false
+	}
+
+	filter := s.virgo.req.Filters[0].Facets[0]
+
+	if filter.FacetID != "pool_f" {
+		return false
+	}
+
+	value, excluded := excludedFilterValue(filter.Value)
+	if excluded == true {
+		return false
+	}
+
+	return s.getInternalSolrValue("pool_f", value) == s.resourceTypeCtx.Value
+}
+
 func (s *searchContext) parseRequest(into interface{}) searchResponse {
 	body, err := s.client.ginCtx.GetRawData()
 	if err != nil {
@@ -660,7 +811,7 @@ func (s *searchContext) performSearchRequest() searchResponse {
 		flags := s.virgo.flags
 
 		if top, err = s.performSpeculativeSearches(); err != nil {
-			return searchResponse{status: http.StatusInternalServerError, err: err}
+			return searchResponse{status: statusFromError(err, http.StatusInternalServerError), err: err}
 		}
 
 		// use query syntax from chosen search
@@ -669,19 +820,23 @@ func (s *searchContext) performSearchRequest() searchResponse {
 		// restore original request flags
 		s.virgo.flags = flags
 
-		// now do the search
-		if resp := s.getPoolQueryResults(); resp.err != nil {
+		// now do the search (the only one that needs spelling suggestions)
+		s.virgo.flags.spellcheck = s.pool.config.Local.Solr.Spellcheck.Enabled
+		resp := s.getPoolQueryResults()
+		s.virgo.flags.spellcheck = false
+
+		if resp.err != nil {
 			return resp
 		}
 
 		// populate group list, if this is a grouped request
 		if err = s.populateGroups(); err != nil {
-			return searchResponse{status: http.StatusInternalServerError, err: err}
+			return searchResponse{status: statusFromError(err, http.StatusInternalServerError), err: err}
 		}
 
 		// augment each record within each group with highlighted snippets, if applicable
 		if err = s.augmentGroupedRecordsWithHighlightedSnippets(); err != nil {
-			return searchResponse{status: http.StatusInternalServerError, err: err}
+			return searchResponse{status: statusFromError(err, http.StatusInternalServerError), err: err}
 		}
 
 		// restore actual confidence
@@ -702,20 +857,7 @@ func (s *searchContext) performSearchRequest() searchResponse {
 	return searchResponse{status: http.StatusOK}
 }
 
-type facetResponse struct {
-	index  int
-	facets []v4api.Facet
-	resp   searchResponse
-}
-
-func (s *searchContext) getFacetResults(index int, channel chan *facetResponse, selectedFacet v4api.Facet, selectedValues []string) {
-	res := facetResponse{index: index}
-	start := time.Now()
-
-	if res.resp = s.getPoolQueryResults(); res.resp.err == nil {
-		res.facets = s.virgo.poolRes.FacetList
-	}
-
+func (s *searchContext) appendSelectedFacetValues(facet *v4api.Facet, selectedFacet v4api.Facet, selectedValues []string) {
 	// ensure any currently selected values for this facet appear in the returned facets list
 
 	// due to limits in the number of entries returned for a facet, in some scenarios,
@@ -723,45 +865,54 @@ func (s *searchContext) getFacetResults(index int, channel chan *facetResponse,
 	// this causes the client to place them in the "Not Applicable" filter list.
 	// to work around this, we ensure all selected facet values appear in the list returned.
 
-	if len(selectedValues) > 0 {
-		// NOTE: facet results may not exist if the user refined an already-faceted search keyword
-		if res.facets != nil {
-			for _, selectedValue := range selectedValues {
-				// check for this value in returned list
-				found := false
-				for _, bucket := range res.facets[0].Buckets {
-					if selectedValue == bucket.Value {
-						found = true
-						break
-					}
-				}
+	if len(selectedValues) == 0 {
+		return
+	}
 
-				if found == false {
-					// find it in the selected facet search results and append it
-					appended := false
-					for _, selectedBucket := range selectedFacet.Buckets {
-						if selectedBucket.Value == selectedValue {
-							s.warn("FACET: %s: appending existing value to truncated results: [%s]", s.virgo.currentFacet, selectedValue)
-							res.facets[0].Buckets = append(res.facets[0].Buckets, selectedBucket)
-							appended = true
-							break
-						}
-					}
+	// NOTE: facet results may not exist if the user refined an already-faceted search keyword
+	if facet == nil {
+		s.warn("FACET: %s: search space reduced?  no values returned", selectedFacet.ID)
+		return
+	}
 
-					if appended == false {
-						s.warn("FACET: %s: search space reduced?  could not find existing value to append to results: [%s]", s.virgo.currentFacet, selectedValue)
-					}
-				}
+	for _, selectedValue := range selectedValues {
+		// check for this value in returned list
+		found := false
+		for _, bucket := range facet.Buckets {
+			if selectedValue == bucket.Value {
+				found = true
+				break
 			}
-		} else {
-			s.warn("FACET: %s: search space reduced?  no values returned", s.virgo.currentFacet)
 		}
-	}
 
-	elapsedMS := int64(time.Since(start) / time.Millisecond)
-	log.Printf("=====> %s facet recieved in %d MS <=====", selectedFacet.ID, elapsedMS)
+		if found == true {
+			continue
+		}
+
+		// find it in the selected facet search results and append it
+		appended := false
+		for _, selectedBucket := range selectedFacet.Buckets {
+			if selectedBucket.Value == selectedValue {
+				s.warn("FACET: %s: appending existing value to truncated results: [%s]", facet.ID, selectedValue)
+				facet.Buckets = append(facet.Buckets, selectedBucket)
+				appended = true
+				break
+			}
+		}
+
+		// arbitrary ranges do not correspond to any bucket, and excluded values will not be
+		// found among results with all filters applied, so they are returned on their own
+		_, excluded := excludedFilterValue(selectedValue)
+
+		if appended == false && (facet.Type == "range" || excluded == true) {
+			facet.Buckets = append(facet.Buckets, v4api.FacetBucket{Value: selectedValue, Selected: true})
+			appended = true
+		}
 
-	channel <- &res
+		if appended == false {
+			s.warn("FACET: %s: search space reduced?  could not find existing value to append to results: [%s]", facet.ID, selectedValue)
+		}
+	}
 }
 
 func (s *searchContext) performFacetsRequest() ([]v4api.Facet, searchResponse) {
@@ -775,14 +926,15 @@ func (s *searchContext) performFacetsRequest() ([]v4api.Facet, searchResponse) {
 
 	// if request contains invalid filters, return values for supported filters only, with zero-count values
 	if s.virgo.invalidFilters == true {
-		// we know there is exactly one filter group at this point.
-		// iterate over it and create mappings
+		// iterate over all filter groups and create mappings
 
 		reqMap := make(map[string][]string)
 
-		for _, filter := range s.virgo.req.Filters[0].Facets {
-			if _, rok := s.resourceTypeCtx.filterMap[filter.FacetID]; rok == true {
-				reqMap[filter.FacetID] = append(reqMap[filter.FacetID], filter.Value)
+		for _, filterGroup := range s.virgo.req.Filters {
+			for _, filter := range filterGroup.Facets {
+				if _, rok := s.resourceTypeCtx.filterMap[filter.FacetID]; rok == true {
+					reqMap[filter.FacetID] = append(reqMap[filter.FacetID], filter.Value)
+				}
 			}
 		}
 
@@ -793,7 +945,7 @@ func (s *searchContext) performFacetsRequest() ([]v4api.Facet, searchResponse) {
 		for _, id := range s.resourceTypeCtx.filterIDs {
 			vals := reqMap[id]
 
-			if len(vals) == 0 {
+			if len(vals) == 0 || s.resourceTypeCtx.returnsFacet(id) == false {
 				continue
 			}
 
@@ -810,58 +962,80 @@ func (s *searchContext) performFacetsRequest() ([]v4api.Facet, searchResponse) {
 		return facetList, searchResponse{status: http.StatusOK}
 	}
 
-	// pre-populate solr query so that parallel facet requests don't waste time duplicating this work
+	// short-circuit: empty/* single-keyword searches with no filters in the request, or
+	// just a single selected resource type, can simply use cached filters.
+	// if errors encountered, just fall back to lookups.
 
-	if resp := s.populateSolrQuery(); resp.err != nil {
-		return nil, resp
-	}
+	if s.virgo.flags.bypassFacetCache == false && s.virgo.parserInfo.isSingleKeywordSearch == true {
+		keyword := s.virgo.parserInfo.keywords[0]
+		if keyword == "" || keyword == "*" {
+			auth := s.client.isAuthenticated()
 
-	// short-circuit: empty/* single-keyword searches with no filters in the request
-	// can simply use cached filters.  if errors encountered, just fall back to lookups.
+			var filters []v4api.Facet
+			var err error
 
-	if s.virgo.totalFilters == 0 {
-		// parse original query to determine query type
+			switch {
+			case s.virgo.totalFilters == 0:
+				filters, err = s.pool.localFacetCache.getSpecifiedFilters(auth, s.resourceTypeCtx.filterIDs)
 
-		if s.virgo.parserInfo.isSingleKeywordSearch == true {
-			keyword := s.virgo.parserInfo.keywords[0]
-			if keyword == "" || keyword == "*" {
-				filters, _ := s.pool.localFacetCache.getSpecifiedFilters(s.resourceTypeCtx.filterIDs)
+			case s.isSingleResourceTypeSelection() == true:
+				filters, err = s.pool.localFacetCache.getResourceTypeFilters(auth, s.resourceTypeCtx.Value)
+
+			default:
+				err = errors.New("request not cacheable")
+			}
+
+			if err == nil {
 				s.log("FACETS: keyword * query using facet cache for response")
 				return filters, searchResponse{status: http.StatusOK}
-
 			}
 		}
 	}
 
-	// first, get counts for all currently selected filter values, so we can populate them later if needed
-
-	s.virgo.flags.selectedFacets = true
+	// request all facets in one solr request.  each filter query is tagged with its filter id,
+	// and each facet excludes its own tag, so that each facet's values are counted by applying
+	// all current filters EXCEPT those of its own type.  facets with currently selected values
+	// are also returned with all filters applied, so we can populate them later if needed.
 
-	var selectedFacets []v4api.Facet
 	if resp := s.getPoolQueryResults(); resp.err != nil {
 		return nil, resp
 	}
-	selectedFacets = s.virgo.poolRes.FacetList
 
-	// second, for each filter, request solr facets for that filter by applying all current
-	// filters EXCEPT those of its own type.  combine these into full filter response.
+	facetMap := make(map[string]*v4api.Facet)
+	for i := range s.virgo.poolRes.FacetList {
+		facet := &s.virgo.poolRes.FacetList[i]
+		facetMap[facet.ID] = facet
+	}
 
-	s.virgo.flags.selectedFacets = false
+	selectedFacets := s.populateSelectedFacetList()
 
-	// run facet searches in parallel
+	// combine these into full filter response, in the order the resource type context lists them
 
-	channel := make(chan *facetResponse)
-	facetRequests := 0
+	var facetList []v4api.Facet
 
 	for i := range s.resourceTypeCtx.filters {
 		filter := s.resourceTypeCtx.filters[i]
 
+		if s.resourceTypeCtx.returnsFacet(filter.ID) == false {
+			continue
+		}
+
 		var selectedValues []string
 		// collect currently selected values for this filter, we may need them later
 		for _, filterGroup := range s.virgo.req.Filters {
 			for _, filterFacet := range filterGroup.Facets {
 				if filterFacet.FacetID == filter.ID {
-					selectedValues = append(selectedValues, filterFacet.Value)
+					value := filterFacet.Value
+
+					// range values are compared in canonical form
+					if filter.Type == "range" {
+						bare, excluded := excludedFilterValue(value)
+						if r, err := parseRangeValue(bare); err == nil {
+							value = markedFilterValue(r.String(), excluded)
+						}
+					}
+
+					selectedValues = append(selectedValues, value)
 				}
 			}
 		}
@@ -889,48 +1063,16 @@ func (s *searchContext) performFacetsRequest() ([]v4api.Facet, searchResponse) {
 			}
 		}
 
-		f := s.copySearchContext()
-		f.virgo.solrQuery = s.virgo.solrQuery
-		f.virgo.parserInfo = s.virgo.parserInfo
-		f.virgo.currentFacet = filter.ID
-		facetRequests++
-		go f.getFacetResults(i, channel, selectedFacet, selectedValues)
-	}
-
-	// collect responses
-
-	var facetResps []*facetResponse
-
-	for facetRequests > 0 {
-		facetResp := <-channel
-		facetResps = append(facetResps, facetResp)
-		facetRequests--
-	}
-
-	// sort responses
-
-	sort.Slice(facetResps, func(i, j int) bool {
-		return facetResps[i].index < facetResps[j].index
-	})
+		facet := facetMap[filter.ID]
 
-	// process responses
+		s.appendSelectedFacetValues(facet, selectedFacet, selectedValues)
 
-	var facetList []v4api.Facet
-
-	for i := range facetResps {
-		facetResp := facetResps[i]
-
-		// just return first error encountered
-		if facetResp.resp.err != nil {
-			return nil, facetResp.resp
-		}
-
-		// don't return filters if they have no values (there will be at most one filter)
-		if len(facetResp.facets) == 0 || len(facetResp.facets[0].Buckets) == 0 {
+		// don't return filters if they have no values
+		if facet == nil || len(facet.Buckets) == 0 {
 			continue
 		}
 
-		facetList = append(facetList, facetResp.facets[0])
+		facetList = append(facetList, *facet)
 	}
 
 	return facetList, searchResponse{status: http.StatusOK}
@@ -991,6 +1133,7 @@ func (s *searchContext) handleSearchRequest() searchResponse {
 
 	// group or not based on sort being applied
 	s.virgo.flags.groupResults = s.pool.maps.definedSorts[s.virgo.req.Sort.SortID].GroupResults
+	s.virgo.flags.expandGroups = s.pool.maps.definedSorts[s.virgo.req.Sort.SortID].GroupStrategy == "expand"
 
 	// check for visible records first (note that zero results is considered successful)
 	visibleResp := s.performSearchRequest()
@@ -1083,7 +1226,7 @@ func (s *searchContext) handleFacetsRequest() searchResponse {
 }
 
 func (s *searchContext) handleFiltersRequest() searchResponse {
-	filters, err := s.pool.globalFacetCache.getPreSearchFilters()
+	filters, err := s.pool.globalFacetCache.getPreSearchFilters(s.client.isAuthenticated())
 
 	if err != nil {
 		resp := searchResponse{status: http.StatusServiceUnavailable, err: err}
@@ -1192,8 +1335,14 @@ func (s *searchContext) getHiddenRecord() searchResponse {
 func (s *searchContext) handleRecordRequest() searchResponse {
 	s.virgo.endpoint = "resource"
 
+	id := s.client.ginCtx.Param("id")
+
+	if err := validateSolrValue("record id", id); err != nil {
+		return searchResponse{status: http.StatusBadRequest, err: err}
+	}
+
 	// fill out Solr query directly, bypassing query syntax parser
-	s.virgo.solrQuery = fmt.Sprintf(`id:"%s"`, s.client.ginCtx.Param("id"))
+	s.virgo.solrQuery = solrFieldPhrase("id", id)
 	s.virgo.flags.groupResults = false
 
 	// mark this as a resource request
@@ -1222,12 +1371,12 @@ func (s *searchContext) handleRecordRequest() searchResponse {
 	return visibleResp
 }
 
-func (s *searchContext) handlePingRequest() searchResponse {
+func (s *searchContext) handlePingRequest(r *solrReplica) searchResponse {
 	s.virgo.endpoint = "ping"
 
-	if err := s.solrPing(); err != nil {
+	if err := s.solrPing(r); err != nil {
 		s.err("ping execution error: %s", err.Error())
-		return searchResponse{status: http.StatusInternalServerError, err: err}
+		return searchResponse{status: statusFromError(err, http.StatusInternalServerError), err: err}
 	}
 
 	return searchResponse{status: http.StatusOK}
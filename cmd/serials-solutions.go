@@ -46,7 +46,12 @@ type serialsSolutionsResponse struct {
 func (s *searchContext) serialsSolutionsLookup(genre string, serialType string, serials []string) (*serialsSolutionsResponse, error) {
 	ctx := s.pool.serialsSolutions
 
-	req, reqErr := http.NewRequest("GET", ctx.url, nil)
+	if err := s.requestAbandoned(); err != nil {
+		s.log("SSAPI: not issuing request: %s", err.Error())
+		return nil, err
+	}
+
+	req, reqErr := http.NewRequestWithContext(s.ctx, "GET", ctx.url, nil)
 	if reqErr != nil {
 		s.log("SSAPI: NewRequest() failed: %s", reqErr.Error())
 		return nil, fmt.Errorf("failed to create Serials Solutions API request")
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/uvalib/virgo4-api/v4api"
+)
+
+// "similar items" for a record, using solr's more-like-this query parser.
+// results are restricted to the same resource type as the source record.
+
+const defaultSimilarRows = 10
+
+func (s *searchContext) solrMoreLikeThisQuery(id string) string {
+	cfg := s.pool.config.Local.Solr.MoreLikeThis
+
+	params := []string{fmt.Sprintf("qf=%s", solrLocalParam(strings.Join(cfg.Fields, ",")))}
+
+	if cfg.MinTermFreq != "" {
+		params = append(params, fmt.Sprintf("mintf=%s", solrLocalParam(cfg.MinTermFreq)))
+	}
+
+	if cfg.MinDocFreq != "" {
+		params = append(params, fmt.Sprintf("mindf=%s", solrLocalParam(cfg.MinDocFreq)))
+	}
+
+	if cfg.MaxQueryTerms != "" {
+		params = append(params, fmt.Sprintf("maxqt=%s", solrLocalParam(cfg.MaxQueryTerms)))
+	}
+
+	// the source record itself is excluded by the query parser
+	params = append(params, fmt.Sprintf("v=%s", solrLocalParam(id)))
+
+	return fmt.Sprintf("{!mlt %s}", strings.Join(params, " "))
+}
+
+func (s *searchContext) handleSimilarRequest() searchResponse {
+	s.virgo.endpoint = "similar"
+
+	id := s.client.ginCtx.Param("id")
+
+	if err := validateSolrValue("record id", id); err != nil {
+		return searchResponse{status: http.StatusBadRequest, err: err}
+	}
+
+	if len(s.pool.config.Local.Solr.MoreLikeThis.Fields) == 0 {
+		return searchResponse{status: http.StatusNotImplemented, err: fmt.Errorf("similar items not supported by this pool")}
+	}
+
+	// find the source record, which must be visible
+
+	s.virgo.solrQuery = solrFieldPhrase("id", id)
+	s.virgo.flags.groupResults = false
+
+	if resp := s.getSingleDocument(); resp.err != nil {
+		return resp
+	}
+
+	// similar records come from the same resource type context as the source record
+
+	pool := s.solr.res.meta.firstDoc.getFirstString("pool_f")
+	if pool == "" {
+		pool = s.pool.config.Global.ResourceTypes.DefaultContext
+	}
+
+	if ctx := s.pool.maps.resourceTypeContexts[pool]; ctx != nil {
+		s.resourceTypeCtx = ctx
+	}
+
+	c := s.copySearchContext()
+
+	c.virgo.solrQuery = s.solrMoreLikeThisQuery(id)
+	c.virgo.filterQueries = []string{solrFieldPhrase("pool_f", pool)}
+
+	rows := s.pool.config.Local.Solr.MoreLikeThis.Rows
+	if rows <= 0 {
+		rows = defaultSimilarRows
+	}
+
+	c.virgo.req.Pagination = v4api.Pagination{Start: 0, Rows: rows}
+
+	if resp := c.getPoolQueryResults(); resp.err != nil {
+		return resp
+	}
+
+	records := []v4api.Record{}
+	if len(c.virgo.poolRes.Groups) > 0 {
+		records = c.virgo.poolRes.Groups[0].Records
+	}
+
+	return searchResponse{status: http.StatusOK, data: records}
+}
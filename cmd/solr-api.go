@@ -16,6 +16,7 @@ type solrParserInfo struct {
 	keywords                 []string
 	fulltexts                []string
 	identifiers              []string
+	booleanOperators         []string // boolean operators between field queries or values, e.g. "AND"
 }
 
 type solrRequestParams struct {
@@ -28,6 +29,22 @@ type solrRequestParams struct {
 	Fq         []string `json:"fq,omitempty"`
 	Q          string   `json:"q,omitempty"`
 	DebugQuery string   `json:"debugQuery,omitempty"`
+	CursorMark string   `json:"cursorMark,omitempty"`
+
+	// spellcheck options
+	Spellcheck                       string `json:"spellcheck,omitempty"`
+	SpellcheckQ                      string `json:"spellcheck.q,omitempty"`
+	SpellcheckDictionary             string `json:"spellcheck.dictionary,omitempty"`
+	SpellcheckCount                  string `json:"spellcheck.count,omitempty"`
+	SpellcheckCollate                string `json:"spellcheck.collate,omitempty"`
+	SpellcheckMaxCollations          string `json:"spellcheck.maxCollations,omitempty"`
+	SpellcheckMaxCollationTries      string `json:"spellcheck.maxCollationTries,omitempty"`
+	SpellcheckCollateExtendedResults string `json:"spellcheck.collateExtendedResults,omitempty"`
+
+	// expand options (single-request grouping)
+	Expand     string `json:"expand,omitempty"`
+	ExpandRows string `json:"expand.rows,omitempty"`
+	ExpandSort string `json:"expand.sort,omitempty"`
 
 	// highlighter options
 	Hl                  string   `json:"hl,omitempty"`
@@ -44,19 +61,30 @@ type solrRequestParams struct {
 }
 
 type solrRequestSubFacet struct {
-	GroupCount string `json:"group_count"`
+	GroupCount string            `json:"group_count"`
+	Children   *solrRequestFacet `json:"children,omitempty"` // second level of hierarchy facets
+}
+
+type solrRequestFacetDomain struct {
+	ExcludeTags []string `json:"excludeTags,omitempty"`
 }
 
 type solrRequestFacet struct {
-	Type     string              `json:"type,omitempty"`
-	Field    string              `json:"field,omitempty"`
-	Query    string              `json:"query,omitempty"`
-	Sort     string              `json:"sort,omitempty"`
-	Offset   int                 `json:"offset,omitempty"`
-	Limit    int                 `json:"limit,omitempty"`
-	MinCount int                 `json:"mincount,omitempty"`
-	Facet    solrRequestSubFacet `json:"facet,omitempty"`
-	config   *poolConfigFilter
+	Type       string                  `json:"type,omitempty"`
+	Field      string                  `json:"field,omitempty"`
+	Query      string                  `json:"query,omitempty"`
+	Prefix     string                  `json:"prefix,omitempty"`
+	Start      string                  `json:"start,omitempty"`
+	End        string                  `json:"end,omitempty"`
+	Gap        string                  `json:"gap,omitempty"`
+	Sort       string                  `json:"sort,omitempty"`
+	Offset     int                     `json:"offset,omitempty"`
+	Limit      int                     `json:"limit,omitempty"`
+	MinCount   int                     `json:"mincount,omitempty"`
+	NumBuckets bool                    `json:"numBuckets,omitempty"`
+	Facet      solrRequestSubFacet     `json:"facet,omitempty"`
+	Domain     *solrRequestFacetDomain `json:"domain,omitempty"`
+	config     *poolConfigFilter
 }
 
 type solrRequestJSON struct {
@@ -78,8 +106,11 @@ type solrMeta struct {
 	numRows        int                          // for client pagination -- numGroups or numRecords
 	totalRows      int                          // for client pagination -- totalGroups or totalRecords
 	selectionMap   map[string]map[string]string // to track what filters have been applied by the client
+	exclusionMap   map[string]map[string]string // to track what filter values have been excluded by the client
 	internalFacets map[string]*solrRequestFacet // to track internal facet info for externally-advertised facets
 	requestFacets  map[string]*solrRequestFacet // to track facets sent in the solr request
+	selectedFacets map[string]*solrRequestFacet // to track facets sent in the solr request for currently selected filters
+	cacheHit       bool                         // whether the response came from the solr response cache
 }
 
 type solrRequest struct {
@@ -95,14 +126,16 @@ type solrResponseHeader struct {
 type solrDocument map[string]interface{}
 
 type solrBucket struct {
-	Val        string `json:"val"`
-	Count      int    `json:"count"`
-	GroupCount int    `json:"group_count"`
+	Val        string             `json:"val"`
+	Count      int                `json:"count"`
+	GroupCount int                `json:"group_count"`
+	Children   *solrResponseFacet `json:"children,omitempty"` // second level of hierarchy facets
 }
 
 type solrResponseFacet struct {
 	Count      int          `json:"count"`
 	GroupCount int          `json:"group_count"`
+	NumBuckets int          `json:"numBuckets"`
 	Buckets    []solrBucket `json:"buckets,omitempty"`
 }
 
@@ -123,14 +156,21 @@ type solrError struct {
 
 // a catch-all for search and ping responses
 type solrResponse struct {
-	ResponseHeader solrResponseHeader           `json:"responseHeader,omitempty"`
-	Response       solrResponseDocuments        `json:"response,omitempty"`
-	Highlighting   solrResponseHighlighting     `json:"highlighting,omitempty"`
-	Debug          interface{}                  `json:"debug,omitempty"`
-	FacetsRaw      map[string]interface{}       `json:"facets,omitempty"`
-	Facets         map[string]solrResponseFacet // will be parsed from FacetsRaw
-	Terms          map[string][]interface{}     `json:"terms,omitempty"`
-	Error          solrError                    `json:"error,omitempty"`
-	Status         string                       `json:"status,omitempty"`
-	meta           *solrMeta                    // pointer to struct in corresponding solrRequest
+	ResponseHeader solrResponseHeader               `json:"responseHeader,omitempty"`
+	Response       solrResponseDocuments            `json:"response,omitempty"`
+	Highlighting   solrResponseHighlighting         `json:"highlighting,omitempty"`
+	Debug          interface{}                      `json:"debug,omitempty"`
+	FacetsRaw      map[string]interface{}           `json:"facets,omitempty"`
+	Facets         map[string]solrResponseFacet     // will be parsed from FacetsRaw
+	Terms          map[string][]interface{}         `json:"terms,omitempty"`
+	Expanded       map[string]solrResponseDocuments `json:"expanded,omitempty"`
+	Error          solrError                        `json:"error,omitempty"`
+	Status         string                           `json:"status,omitempty"`
+	Spellcheck     solrResponseSpellcheck           `json:"spellcheck,omitempty"`
+	NextCursorMark string                           `json:"nextCursorMark,omitempty"`
+	meta           *solrMeta                        // pointer to struct in corresponding solrRequest
+}
+
+type solrResponseSpellcheck struct {
+	Collations []interface{} `json:"collations,omitempty"` // alternating "collation" labels and collation details
 }
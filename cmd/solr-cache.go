@@ -0,0 +1,307 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+// in-process LRU cache of raw solr responses, keyed on the marshalled solr request
+// plus any auth-dependent fields (see solrRequestKey).  the entire cache is invalidated whenever the
+// solr index version changes, which is detected by periodically polling solr.
+// nothing is cached while the index version is unknown, so entries are never of unknown age.
+
+// consecutive failed index version checks after which the cache is suspended
+const solrIndexVersionMaxFailures = 3
+
+type solrCacheEntry struct {
+	key  string
+	body []byte
+}
+
+type solrCache struct {
+	mu            sync.Mutex
+	size          int
+	entries       map[string]*list.Element
+	lru           *list.List // front is most recently used
+	version       string     // index version the cached entries belong to
+	known         bool       // whether the index version is currently known
+	hits          int64
+	misses        int64
+	evictions     int64
+	invalidations int64
+}
+
+type solrCacheStats struct {
+	Size          int    `json:"size"`
+	Entries       int    `json:"entries"`
+	Hits          int64  `json:"hits"`
+	Misses        int64  `json:"misses"`
+	Evictions     int64  `json:"evictions"`
+	Invalidations int64  `json:"invalidations"`
+	IndexVersion  string `json:"index_version,omitempty"`
+}
+
+type solrIndexVersionResponse struct {
+	Index struct {
+		Version int64 `json:"version,omitempty"`
+	} `json:"index,omitempty"` // luke handler
+	IndexVersion int64 `json:"indexversion,omitempty"` // replication handler
+}
+
+func newSolrCache(size int) *solrCache {
+	// a size of 0 disables the cache
+	if size <= 0 {
+		return nil
+	}
+
+	c := solrCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+
+	return &c
+}
+
+func solrRequestKey(req []byte, claims *v4jwt.V4Claims) string {
+	// identifies a solr request for caching and coalescing purposes.
+	// responses do not currently vary by user, but the mapping of them does,
+	// so keep requests for different auth levels separate to be safe
+
+	auth := "anonymous"
+	if claims != nil {
+		auth = fmt.Sprintf("%s|%t", claims.Role.String(), claims.IsUVA)
+	}
+
+	sum := sha256.Sum256(append([]byte(auth+"\n"), req...))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *solrCache) currentVersion() string {
+	if c == nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.version
+}
+
+func (c *solrCache) get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if c.known == false || ok == false {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	c.lru.MoveToFront(elem)
+
+	return elem.Value.(*solrCacheEntry).body, true
+}
+
+func (c *solrCache) put(key string, body []byte, version string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the index changed while this request was in flight, or is not currently known
+	if c.known == false || version != c.version {
+		return
+	}
+
+	if elem, ok := c.entries[key]; ok == true {
+		elem.Value.(*solrCacheEntry).body = body
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&solrCacheEntry{key: key, body: body})
+
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*solrCacheEntry).key)
+		c.evictions++
+	}
+}
+
+func (c *solrCache) setVersion(version string) bool {
+	// records the current index version, dropping all entries if it changed.
+	// returns whether the cache was invalidated.
+
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.known == true && version == c.version {
+		return false
+	}
+
+	// the first version seen is not an invalidation
+	if c.version != "" {
+		c.invalidations++
+	}
+
+	c.version = version
+	c.known = true
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+
+	return true
+}
+
+func (c *solrCache) suspend() bool {
+	// drops all entries and stops caching until the index version is known again.
+	// returns whether the cache was suspended.
+
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.known == false {
+		return false
+	}
+
+	c.known = false
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+
+	return true
+}
+
+func (c *solrCache) stats() solrCacheStats {
+	if c == nil {
+		return solrCacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return solrCacheStats{
+		Size:          c.size,
+		Entries:       c.lru.Len(),
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Evictions:     c.evictions,
+		Invalidations: c.invalidations,
+		IndexVersion:  c.version,
+	}
+}
+
+func (s *searchContext) solrIndexVersion(r *solrReplica) (string, error) {
+	ctx := r.indexVersion
+
+	req, reqErr := http.NewRequestWithContext(s.ctx, "GET", ctx.url, nil)
+	if reqErr != nil {
+		s.log("SOLR: NewRequest() failed: %s", reqErr.Error())
+		return "", fmt.Errorf("failed to create Solr request")
+	}
+
+	res, resErr := ctx.do(req, false)
+	if resErr != nil {
+		s.log("SOLR: client.Do() failed: %s", resErr.Error())
+		return "", fmt.Errorf("failed to receive Solr response")
+	}
+
+	defer res.Body.Close()
+
+	var vr solrIndexVersionResponse
+
+	if decErr := json.NewDecoder(res.Body).Decode(&vr); decErr != nil {
+		s.log("SOLR: Decode() failed: %s", decErr.Error())
+		return "", fmt.Errorf("failed to decode Solr response")
+	}
+
+	version := vr.Index.Version
+	if version == 0 {
+		version = vr.IndexVersion
+	}
+
+	if version == 0 {
+		return "", fmt.Errorf("no index version in Solr response")
+	}
+
+	return fmt.Sprintf("%d", version), nil
+}
+
+func (p *poolContext) monitorSolrIndexVersion(interval int) {
+	c := clientContext{}
+	c.init(p, nil)
+	c.reqID = "solr-index-version"
+
+	failures := 0
+
+	for {
+		s := searchContext{}
+		s.init(p, &c)
+
+		// replicas may be at different versions while replicating; treat the versions
+		// of those that answered as a set.  replicas that failed to answer are skipped,
+		// as any response they do serve will come from one of these versions.
+
+		var versions []string
+
+		for _, r := range p.solr.replicas {
+			version, err := s.solrIndexVersion(r)
+			if err != nil {
+				s.warn("index version check failed for %s: %s", r.host, err.Error())
+				continue
+			}
+
+			if sliceContainsString(versions, version, false) == false {
+				versions = append(versions, version)
+			}
+		}
+
+		if len(versions) > 0 {
+			failures = 0
+
+			sort.Strings(versions)
+			version := strings.Join(versions, ",")
+
+			if p.solr.cache.setVersion(version) == true {
+				log.Printf("[CACHE] solr index version is now [%s]; response cache invalidated", version)
+			}
+		} else {
+			failures++
+
+			// the index may have changed in the meantime, so stop serving cached responses
+			if failures >= solrIndexVersionMaxFailures && p.solr.cache.suspend() == true {
+				log.Printf("[CACHE] solr index version unknown after %d failed checks; response cache suspended", failures)
+			}
+		}
+
+		if p.wait(interval) == false {
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSolrCacheEviction(t *testing.T) {
+	c := newSolrCache(2)
+	c.setVersion("1")
+
+	c.put("a", []byte("a"), "1")
+	c.put("b", []byte("b"), "1")
+
+	// a is now the most recently used, so b is evicted next
+	if _, ok := c.get("a"); ok == false {
+		t.Fatalf("expected a to be cached")
+	}
+
+	c.put("c", []byte("c"), "1")
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if body, ok := c.get(key); ok != want || (ok == true && string(body) != key) {
+			t.Errorf("get(%s): got [%s] (cached: %v), want cached: %v", key, body, ok, want)
+		}
+	}
+
+	if st := c.stats(); st.Entries != 2 || st.Evictions != 1 {
+		t.Errorf("got %d entries and %d evictions, want 2 and 1", st.Entries, st.Evictions)
+	}
+}
+
+func TestSolrCacheVersion(t *testing.T) {
+	c := newSolrCache(10)
+
+	cached := func(key string) bool {
+		_, ok := c.get(key)
+		return ok
+	}
+
+	// nothing is cached until the index version is known
+	c.put("a", []byte("a"), "")
+	if cached("a") == true {
+		t.Fatalf("cached a response before the index version was known")
+	}
+
+	if c.setVersion("1") == false {
+		t.Fatalf("first version not recorded")
+	}
+
+	c.put("a", []byte("a"), "1")
+
+	if c.setVersion("1") == true || cached("a") == false {
+		t.Fatalf("unchanged version invalidated the cache")
+	}
+
+	// responses fetched against an earlier index version are not cached
+	c.put("b", []byte("b"), "0")
+	if cached("b") == true {
+		t.Errorf("cached a response from a stale index version")
+	}
+
+	if c.setVersion("2") == false || cached("a") == true {
+		t.Fatalf("changed version did not invalidate the cache")
+	}
+
+	c.put("a", []byte("a"), "2")
+
+	if c.suspend() == false || cached("a") == true {
+		t.Fatalf("suspension did not empty the cache")
+	}
+
+	c.put("a", []byte("a"), "2")
+	if cached("a") == true {
+		t.Errorf("cached a response while suspended")
+	}
+
+	if c.setVersion("2") == false {
+		t.Fatalf("known version not recorded after suspension")
+	}
+
+	c.put("a", []byte("a"), "2")
+	if cached("a") == false {
+		t.Errorf("caching did not resume once the version was known again")
+	}
+
+	if st := c.stats(); st.Invalidations != 2 || st.IndexVersion != "2" {
+		t.Errorf("got %d invalidations at version [%s], want 2 at [2]", st.Invalidations, st.IndexVersion)
+	}
+}
+
+func TestSolrCacheDisabled(t *testing.T) {
+	c := newSolrCache(0)
+
+	c.setVersion("1")
+	c.put("a", []byte("a"), "1")
+
+	if _, ok := c.get("a"); ok == true {
+		t.Errorf("disabled cache returned a response")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// coalescing of identical in-flight solr requests: the first caller issues the request,
+// and any identical requests arriving before it completes wait for its raw response
+// rather than issuing their own.  each caller decodes the raw response into its own
+// search context, so nothing is shared by pointer.
+
+type solrFetchResult struct {
+	body      []byte // raw response body; must not be modified
+	method    string
+	url       string
+	elapsedMS int64
+}
+
+type solrInflightCall struct {
+	done    chan struct{}
+	res     solrFetchResult
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+type solrInflight struct {
+	mu        sync.Mutex
+	calls     map[string]*solrInflightCall
+	coalesced int64 // number of requests served by another request's response
+}
+
+func (g *solrInflight) do(ctx context.Context, key string, fetch func(context.Context) (solrFetchResult, error)) (solrFetchResult, bool, error) {
+	// returns the fetched result, and whether it was shared with an earlier identical request
+
+	g.mu.Lock()
+
+	if g.calls == nil {
+		g.calls = make(map[string]*solrInflightCall)
+	}
+
+	call, shared := g.calls[key]
+
+	if shared == true {
+		g.coalesced++
+	} else {
+		// the fetch outlives any one caller; it is only cancelled once every caller has gone away
+		fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+		call = &solrInflightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+
+		go func() {
+			call.res, call.err = fetch(fetchCtx)
+
+			g.mu.Lock()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+
+			cancel()
+			close(call.done)
+		}()
+	}
+
+	call.waiters++
+
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.res, shared, call.err
+
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// nobody is left waiting; abandon the fetch, and make sure later requests start a new one
+			call.cancel()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+
+		return solrFetchResult{}, shared, contextStatusError(ctx.Err())
+	}
+}
+
+func (g *solrInflight) coalescedCount() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.coalesced
+}
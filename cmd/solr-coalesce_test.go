@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitForWaiters(t *testing.T, g *solrInflight, key string, n int) {
+	// waits until the given number of callers are waiting on the in-flight call
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		call := g.calls[key]
+		waiters := 0
+		if call != nil {
+			waiters = call.waiters
+		}
+		g.mu.Unlock()
+
+		if waiters == n {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for %d callers", n)
+}
+
+func TestSolrInflightSharesFetch(t *testing.T) {
+	const callers = 5
+
+	var g solrInflight
+	var fetches int32
+
+	release := make(chan struct{})
+
+	fetch := func(ctx context.Context) (solrFetchResult, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return solrFetchResult{body: []byte("response")}, nil
+	}
+
+	var wg sync.WaitGroup
+	var sharedCount int32
+
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res, shared, err := g.do(context.Background(), "key", fetch)
+			if err != nil {
+				t.Errorf("unexpected error: %s", err.Error())
+				return
+			}
+
+			if string(res.body) != "response" {
+				t.Errorf("got body [%s], want [response]", res.body)
+			}
+
+			if shared == true {
+				atomic.AddInt32(&sharedCount, 1)
+			}
+		}()
+	}
+
+	waitForWaiters(t, &g, "key", callers)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("got %d fetches, want 1", got)
+	}
+
+	if got := atomic.LoadInt32(&sharedCount); got != callers-1 {
+		t.Errorf("got %d shared results, want %d", got, callers-1)
+	}
+
+	if got := g.coalescedCount(); got != callers-1 {
+		t.Errorf("got coalesced count %d, want %d", got, callers-1)
+	}
+
+	// a completed fetch is not reused
+	if _, shared, _ := g.do(context.Background(), "key", fetch); shared == true || atomic.LoadInt32(&fetches) != 2 {
+		t.Errorf("later request reused a completed fetch")
+	}
+}
+
+func TestSolrInflightAbandoned(t *testing.T) {
+	var g solrInflight
+
+	started := make(chan context.Context, 1)
+
+	fetch := func(ctx context.Context) (solrFetchResult, error) {
+		started <- ctx
+		<-ctx.Done()
+		return solrFetchResult{}, ctx.Err()
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+
+	errs := make(chan error, 2)
+
+	go func() { _, _, err := g.do(first, "key", fetch); errs <- err }()
+	fetchCtx := <-started
+
+	go func() { _, _, err := g.do(second, "key", fetch); errs <- err }()
+	waitForWaiters(t, &g, "key", 2)
+
+	// the fetch continues while anyone is still waiting for it
+	cancelFirst()
+
+	if err := <-errs; statusFromError(err, 0) != http.StatusRequestTimeout {
+		t.Errorf("got error [%v], want a cancellation", err)
+	}
+
+	select {
+	case <-fetchCtx.Done():
+		t.Fatalf("fetch cancelled while a caller was still waiting")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// ... and is abandoned once nobody is
+	cancelSecond()
+
+	if err := <-errs; statusFromError(err, 0) != http.StatusRequestTimeout {
+		t.Errorf("got error [%v], want a cancellation", err)
+	}
+
+	select {
+	case <-fetchCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("fetch not cancelled once all callers had gone")
+	}
+}
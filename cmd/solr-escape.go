@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// functions that escape/quote values before they are interpolated into solr queries.
+// any value that originates from a client (record ids, filter values, parsed query
+// values, etc.) should pass through one of these rather than being formatted directly.
+
+// maximum length of any single client-supplied value
+const solrMaxValueLength = 1024
+
+func validateSolrValue(label string, value string) error {
+	// reject values that cannot be sensibly represented in a solr query
+
+	if value == "" {
+		return fmt.Errorf("empty %s", label)
+	}
+
+	if len(value) > solrMaxValueLength {
+		return fmt.Errorf("%s exceeds maximum length of %d bytes", label, solrMaxValueLength)
+	}
+
+	if utf8.ValidString(value) == false {
+		return fmt.Errorf("%s is not valid UTF-8", label)
+	}
+
+	for _, r := range value {
+		if unicode.IsControl(r) == true {
+			return fmt.Errorf("%s contains control characters", label)
+		}
+	}
+
+	return nil
+}
+
+func solrQuotePhrase(value string) string {
+	// quote a value for use as a phrase, e.g. field:"value".
+	// only backslashes and double quotes are special within a phrase.
+
+	escaped := strings.ReplaceAll(value, `\`, `\\`)
+	escaped = strings.ReplaceAll(escaped, `"`, `\"`)
+
+	return `"` + escaped + `"`
+}
+
+func solrLocalParam(value string) string {
+	// quote a value for use within local params, e.g. {!tag=value}.
+	// simple values are left as-is; anything else is single-quoted.
+
+	simple := value != ""
+
+	for _, r := range value {
+		if r != '_' && r != '-' && r != '.' && unicode.IsLetter(r) == false && unicode.IsDigit(r) == false {
+			simple = false
+			break
+		}
+	}
+
+	if simple == true {
+		return value
+	}
+
+	escaped := strings.ReplaceAll(value, `\`, `\\`)
+	escaped = strings.ReplaceAll(escaped, `'`, `\'`)
+
+	return `'` + escaped + `'`
+}
+
+func solrFieldPhrase(field string, value string) string {
+	// convenience wrapper for the most common case
+	return fmt.Sprintf(`%s:%s`, field, solrQuotePhrase(value))
+}
+
+func solrFieldPhrases(field string, values []string) string {
+	// matches any of the given values, e.g. field:("value1" OR "value2")
+
+	var phrases []string
+
+	for _, value := range values {
+		phrases = append(phrases, solrQuotePhrase(value))
+	}
+
+	return fmt.Sprintf(`%s:(%s)`, field, strings.Join(phrases, " OR "))
+}
+
+func solrUnescape(value string) (string, error) {
+	// removes one level of backslash escaping
+
+	var b strings.Builder
+
+	escaped := false
+
+	for _, r := range value {
+		if escaped == false && r == '\\' {
+			escaped = true
+			continue
+		}
+
+		b.WriteRune(r)
+		escaped = false
+	}
+
+	if escaped == true {
+		return "", errors.New("dangling escape character")
+	}
+
+	return b.String(), nil
+}
+
+func unescapeParserValue(value string) (string, error) {
+	// field values collected by the v4 query parser are escaped for use within the
+	// quoted portion of a nested solr query, i.e. they are doubly escaped.
+	// this recovers the original value so it can be quoted for another context.
+
+	once, err := solrUnescape(value)
+	if err != nil {
+		return "", err
+	}
+
+	return solrUnescape(once)
+}
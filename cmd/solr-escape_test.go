@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSolrValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		invalid bool
+	}{
+		{name: "plain", value: "history"},
+		{name: "special characters", value: `a+b -c && (d) "e" f:g \h`},
+		{name: "unicode", value: "Zürich ✓"},
+		{name: "empty", value: "", invalid: true},
+		{name: "too long", value: strings.Repeat("x", solrMaxValueLength+1), invalid: true},
+		{name: "maximum length", value: strings.Repeat("x", solrMaxValueLength)},
+		{name: "invalid utf-8", value: "bad\xffvalue", invalid: true},
+		{name: "control character", value: "line\nbreak", invalid: true},
+		{name: "nul", value: "nul\x00", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSolrValue("value", tt.value)
+
+			if tt.invalid == true && err == nil {
+				t.Errorf("expected [%q] to be rejected", tt.value)
+			}
+
+			if tt.invalid == false && err != nil {
+				t.Errorf("unexpected error for [%q]: %s", tt.value, err.Error())
+			}
+		})
+	}
+}
+
+func TestSolrQuotePhrase(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "plain", value: "history of virginia", want: `"history of virginia"`},
+		{name: "empty", value: "", want: `""`},
+		{name: "term special characters", value: "a+b (c) d:e", want: `"a+b (c) d:e"`},
+		{name: "quote", value: `say "hi"`, want: `"say \"hi\""`},
+		{name: "backslash", value: `a\b`, want: `"a\\b"`},
+		{name: "trailing backslash", value: `a\`, want: `"a\\"`},
+		{name: "escaped quote", value: `a\"b`, want: `"a\\\"b"`},
+		{name: "phrase breakout", value: `x" OR *:* OR "y`, want: `"x\" OR *:* OR \"y"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := solrQuotePhrase(tt.value); got != tt.want {
+				t.Errorf("got [%s], want [%s]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSolrLocalParam(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "simple", value: "FilterFormat", want: "FilterFormat"},
+		{name: "simple punctuation", value: "pool_f.v-2", want: "pool_f.v-2"},
+		{name: "empty", value: "", want: "''"},
+		{name: "space", value: "a b", want: "'a b'"},
+		{name: "closing brace", value: "x}*:*", want: "'x}*:*'"},
+		{name: "param injection", value: "x v=$q", want: "'x v=$q'"},
+		{name: "single quote", value: "x' v='y", want: `'x\' v=\'y'`},
+		{name: "backslash", value: `x\`, want: `'x\\'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := solrLocalParam(tt.value); got != tt.want {
+				t.Errorf("got [%s], want [%s]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSolrFieldPhrases(t *testing.T) {
+	got := solrFieldPhrases("id", []string{"u1", `u"2`})
+	want := `id:("u1" OR "u\"2")`
+
+	if got != want {
+		t.Errorf("got [%s], want [%s]", got, want)
+	}
+}
+
+func TestUnescapeParserValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		invalid bool
+	}{
+		{name: "plain", value: "history", want: "history"},
+		{name: "escaped quote", value: `\\\"hi\\\"`, want: `"hi"`},
+		{name: "escaped backslash", value: `a\\\\b`, want: `a\b`},
+		{name: "escaped colon", value: `a\\:b`, want: "a:b"},
+		{name: "singly escaped", value: `a\:b`, want: "a:b"},
+		{name: "dangling escape", value: `a\`, invalid: true},
+		{name: "dangling after first pass", value: `a\\`, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unescapeParserValue(tt.value)
+
+			if tt.invalid == true {
+				if err == nil {
+					t.Errorf("expected [%s] to be rejected, got [%s]", tt.value, got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error for [%s]: %s", tt.value, err.Error())
+			}
+
+			if got != tt.want {
+				t.Errorf("got [%s], want [%s]", got, tt.want)
+			}
+		})
+	}
+}
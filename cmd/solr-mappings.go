@@ -3,7 +3,10 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/uvalib/virgo4-api/v4api"
@@ -11,14 +14,72 @@ import (
 
 // functions that map virgo data into solr data
 
-func (s *solrRequest) buildFilters(ctx *searchContext, filterGroups []v4api.Filter, internalFacets map[string]*solrRequestFacet, availability poolConfigAvailability) {
-	if len(filterGroups) == 0 {
-		return
+// prefix for facets requested with all filters applied (see solrInternalRequestFacets())
+const selectedFacetPrefix = "selected_"
+
+// prefix marking a filter value to be excluded from, rather than selected for, results,
+// e.g. "-Law Library".  a value that itself begins with this prefix or the escape character
+// is escaped with a leading escape character, e.g. `\-1 to 5` selects the value "-1 to 5",
+// and `-\-1 to 5` excludes it.  an escape before anything else is literal.
+const excludedFilterPrefix = "-"
+const filterValueEscape = `\`
+
+// used to count all records (rather than groups) when grouping with the expand component
+const groupCollapseTag = "group_collapse"
+const groupRecordCountFacet = "group_record_count"
+
+func excludedFilterValue(value string) (string, bool) {
+	// returns the filter value without any exclusion prefix or escape, and whether it was excluded.
+	// the escape only applies to a following prefix or escape; before anything else it is literal.
+
+	excluded := strings.HasPrefix(value, excludedFilterPrefix)
+	if excluded == true {
+		value = strings.TrimPrefix(value, excludedFilterPrefix)
+	}
+
+	if strings.HasPrefix(value, filterValueEscape) == true {
+		escaped := strings.TrimPrefix(value, filterValueEscape)
+
+		if strings.HasPrefix(escaped, excludedFilterPrefix) == true || strings.HasPrefix(escaped, filterValueEscape) == true {
+			value = escaped
+		}
+	}
+
+	return value, excluded
+}
+
+func markedFilterValue(value string, excluded bool) string {
+	// returns the filter value as clients send it: escaped if necessary, and prefixed if excluded
+
+	if strings.HasPrefix(value, excludedFilterPrefix) == true || strings.HasPrefix(value, filterValueEscape) == true {
+		value = filterValueEscape + value
 	}
 
-	// we are guaranteed to only have one filter group due to up-front validations
+	if excluded == true {
+		value = excludedFilterPrefix + value
+	}
 
-	filterGroup := filterGroups[0]
+	return value
+}
+
+func validateFilterValueMarker(value string) error {
+	// ensures a filter value's exclusion prefix is followed by something to exclude
+
+	bare := strings.TrimPrefix(value, excludedFilterPrefix)
+
+	if bare == "" && value != "" {
+		return fmt.Errorf("missing value to exclude")
+	}
+
+	return nil
+}
+
+func (s *solrRequest) buildFilterGroup(ctx *searchContext, filterGroup v4api.Filter, internalFacets map[string]*solrRequestFacet, availability poolConfigAvailability) (map[string]string, error) {
+	// returns the filter expression for each filter type in this group.
+	// selected and excluded values are also added to the request-wide selection/exclusion maps.
+
+	selectionMap := make(map[string]map[string]string)
+	exclusionMap := make(map[string]map[string]string)
 
 	for _, filter := range filterGroup.Facets {
 		solrFacet := internalFacets[filter.FacetID]
@@ -34,18 +95,21 @@ func (s *solrRequest) buildFilters(ctx *searchContext, filterGroups []v4api.Filt
 			numSelected := 0
 
 			for _, facet := range dependentFilterIDs {
-				n := len(s.meta.selectionMap[facet])
+				n := len(selectionMap[facet])
 				numSelected += n
 			}
 
 			if numSelected == 0 {
-				s.meta.client.log("FILTER: %s: omitting filter [%s] due to lack of selected dependent filters", ctx.virgo.currentFacet, filter.FacetID)
+				s.meta.client.log("FILTER: omitting filter [%s] due to lack of selected dependent filters", filter.FacetID)
 				continue
 			}
 
-			s.meta.client.log("FILTER: %s: including filter [%s] due to %d selected dependent filters", ctx.virgo.currentFacet, filter.FacetID, numSelected)
+			s.meta.client.log("FILTER: including filter [%s] due to %d selected dependent filters", filter.FacetID, numSelected)
 		}
 
+		// excluded values are marked with a prefix
+		value, excluded := excludedFilterValue(filter.Value)
+
 		var solrFilter string
 		var filterValue string
 
@@ -59,67 +123,223 @@ func (s *solrRequest) buildFilters(ctx *searchContext, filterGroups []v4api.Filt
 					availabilityFacet = availability.FilterConfig.FieldAuth
 				}
 
-				solrFilter = fmt.Sprintf(`(%s:"%s") OR (%s:"Online")`, solrFacet.Field, filterValue, availabilityFacet)
+				solrFilter = fmt.Sprintf(`(%s) OR (%s)`, solrFieldPhrase(solrFacet.Field, filterValue), solrFieldPhrase(availabilityFacet, "Online"))
 			} else {
-				solrFilter = fmt.Sprintf(`%s:"%s"`, solrFacet.Field, filterValue)
+				solrFilter = solrFieldPhrase(solrFacet.Field, filterValue)
+			}
+
+		case "range":
+			canonical, rangeFilter, err := solrRangeFilter(solrFacet.Field, solrFacet.config.Range.ValueType, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for filter [%s]: %s", filter.FacetID, err.Error())
+			}
+
+			filterValue = canonical
+			solrFilter = rangeFilter
+
+		case "hierarchy":
+			if err := validateSolrValue("filter value", value); err != nil {
+				return nil, fmt.Errorf("invalid value for filter [%s]: %s", filter.FacetID, err.Error())
+			}
+
+			parentField := solrFacet.config.Hierarchy.ParentField
+			parent, child := solrFacet.config.splitHierarchyValue(value)
+			parent = ctx.getInternalSolrValue(parentField, parent)
+
+			filterValue = parent
+			solrFilter = solrFieldPhrase(parentField, parent)
+
+			// a child value applies both levels
+			if child != "" {
+				childField := solrFacet.Facet.Children.Field
+				child = ctx.getInternalSolrValue(solrFacet.config.Solr.Field, child)
+
+				filterValue = solrFacet.config.hierarchyValue(parent, child)
+				solrFilter = fmt.Sprintf("%s AND %s", solrFilter, solrFieldPhrase(childField, child))
 			}
 
 		case "component":
-			filterValue = filter.Value
+			filterValue = value
 			q := solrFacet.config.queryMap[filterValue]
 
 			if q == nil {
-				s.meta.client.log("FILTER: %s: unable to map component value to a component query: [%s]", ctx.virgo.currentFacet, filterValue)
+				s.meta.client.log("FILTER: unable to map component value to a component query: [%s]", filterValue)
 				continue
 			}
 
 			solrFilter = q.Query
 
 		default:
-			filterValue = ctx.getInternalSolrValue(solrFacet.config.Solr.Field, filter.Value)
-			solrFilter = fmt.Sprintf(`%s:"%s"`, solrFacet.Field, filterValue)
+			if err := validateSolrValue("filter value", value); err != nil {
+				return nil, fmt.Errorf("invalid value for filter [%s]: %s", filter.FacetID, err.Error())
+			}
+
+			filterValue = ctx.getInternalSolrValue(solrFacet.config.Solr.Field, value)
+			solrFilter = solrFieldPhrase(solrFacet.Field, filterValue)
 		}
 
-		// add this filter to selection map
-		if s.meta.selectionMap[filter.FacetID] == nil {
-			s.meta.selectionMap[filter.FacetID] = make(map[string]string)
+		// add this filter to selection map, or exclusion map.
+		// excluded values are tracked separately, as they do not count as selections.
+		groupMap, requestMap := selectionMap, s.meta.selectionMap
+		if excluded == true {
+			groupMap, requestMap = exclusionMap, s.meta.exclusionMap
 		}
 
-		s.meta.selectionMap[filter.FacetID][filterValue] = solrFilter
+		for _, filterMap := range []map[string]map[string]string{groupMap, requestMap} {
+			if filterMap[filter.FacetID] == nil {
+				filterMap[filter.FacetID] = make(map[string]string)
+			}
+
+			filterMap[filter.FacetID][filterValue] = solrFilter
+		}
 	}
 
-	// build filter query based on OR'd filter values among AND'd filter types
+	// build filter query based on OR'd filter values among AND'd filter types,
+	// less any excluded values of each filter type.  filter types configured to
+	// match all selected values AND their values instead.
+	// values are sorted, so that identical requests produce identical solr requests
+	// (see solrRequestKey() and solrInflight).
+
+	filterIDs := make(map[string]bool)
+	for filterID := range selectionMap {
+		filterIDs[filterID] = true
+	}
+	for filterID := range exclusionMap {
+		filterIDs[filterID] = true
+	}
 
-	var orFilters []string
+	filters := make(map[string]string)
 
-	for filterID, selectedValues := range s.meta.selectionMap {
+	for filterID := range filterIDs {
 		var idFilters []string
-		for _, solrFilter := range selectedValues {
-			idFilters = append(idFilters, fmt.Sprintf("(%s)", solrFilter))
+		for _, filterValue := range slices.Sorted(maps.Keys(selectionMap[filterID])) {
+			idFilters = append(idFilters, fmt.Sprintf("(%s)", selectionMap[filterID][filterValue]))
+		}
+
+		op := " OR "
+		if internalFacets[filterID] != nil && internalFacets[filterID].config.Match == "all" {
+			op = " AND "
+		}
+
+		// a purely negative clause matches nothing once nested (e.g. within a filter group),
+		// so excluded values without any selected values are subtracted from all records
+		clauses := []string{"*:*"}
+		if len(idFilters) > 0 {
+			clauses = []string{fmt.Sprintf("(%s)", strings.Join(idFilters, op))}
+		}
+
+		for _, filterValue := range slices.Sorted(maps.Keys(exclusionMap[filterID])) {
+			clauses = append(clauses, fmt.Sprintf("-(%s)", exclusionMap[filterID][filterValue]))
+		}
+
+		filters[filterID] = strings.Join(clauses, " AND ")
+	}
+
+	return filters, nil
+}
+
+func (s *solrRequest) buildFilters(ctx *searchContext, filterGroups []v4api.Filter, internalFacets map[string]*solrRequestFacet, availability poolConfigAvailability) error {
+	if len(filterGroups) == 0 {
+		return nil
+	}
+
+	// a single filter group is applied as one filter query per filter type
+
+	if len(filterGroups) == 1 {
+		filters, err := s.buildFilterGroup(ctx, filterGroups[0], internalFacets, availability)
+		if err != nil {
+			return err
+		}
+
+		// sorted for consistency (e.g. for caching)
+		for _, filterID := range slices.Sorted(maps.Keys(filters)) {
+			orFilter := filters[filterID]
+
+			// when requesting facets, tag each filter query with its filter id so that
+			// each facet can exclude its own filter, and return all possible matching values
+			if ctx.virgo.flags.facetCache == false && ctx.virgo.flags.requestFacets == true {
+				orFilter = fmt.Sprintf("{!tag=%s}%s", solrLocalParam(filterID), orFilter)
+			}
+
+			s.meta.client.log("FILTER: applying filter: %s : %s", filterID, orFilter)
+
+			s.json.Params.Fq = append(s.json.Params.Fq, orFilter)
+		}
+
+		return nil
+	}
+
+	// multiple filter groups are each AND'd together, and the groups combined into a single
+	// filter query.  there is no one filter query per filter type for a facet to exclude,
+	// so facets are counted within the current results.
+
+	op := " OR "
+	if ctx.pool.config.Global.Service.FilterGroupOperator == "AND" {
+		op = " AND "
+	}
+
+	var groupFilters []string
+
+	for i, filterGroup := range filterGroups {
+		filters, err := s.buildFilterGroup(ctx, filterGroup, internalFacets, availability)
+		if err != nil {
+			return err
 		}
 
-		orFilter := strings.Join(idFilters, " OR ")
+		if len(filters) == 0 {
+			// an empty group matches everything, so can only be ignored when groups are AND'd
+			if op == " OR " {
+				s.meta.client.log("FILTER: filter group %d is empty; not applying any filter groups", i)
+				return nil
+			}
 
-		// when iterating over facets, do not include current facet in filter queries
-		// so that all possible matching values for this facet are returned
-		if ctx.virgo.flags.facetCache == false && ctx.virgo.flags.requestFacets == true && ctx.virgo.flags.selectedFacets == false && filterID == ctx.virgo.currentFacet {
-			s.meta.client.log("FILTER: %s: SKIPPING filter: %s : %s", ctx.virgo.currentFacet, filterID, orFilter)
 			continue
 		}
 
-		s.meta.client.log("FILTER: %s: applying filter: %s : %s", ctx.virgo.currentFacet, filterID, orFilter)
+		// sorted for consistency (e.g. for caching)
+		var clauses []string
+		for _, filter := range filters {
+			clauses = append(clauses, fmt.Sprintf("(%s)", filter))
+		}
+		sort.Strings(clauses)
+
+		groupFilters = append(groupFilters, fmt.Sprintf("(%s)", strings.Join(clauses, " AND ")))
+	}
 
-		orFilters = append(orFilters, orFilter)
+	if len(groupFilters) == 0 {
+		return nil
 	}
 
-	s.json.Params.Fq = append(s.json.Params.Fq, orFilters...)
+	groupFilter := strings.Join(groupFilters, op)
+
+	s.meta.client.log("FILTER: applying filter groups: %s", groupFilter)
+
+	s.json.Params.Fq = append(s.json.Params.Fq, groupFilter)
+
+	return nil
 }
 
-func (s *searchContext) solrInternalRequestFacets() (map[string]*solrRequestFacet, map[string]*solrRequestFacet) {
+func (s *searchContext) solrInternalRequestFacets() (map[string]*solrRequestFacet, map[string]*solrRequestFacet, map[string]*solrRequestFacet) {
 	// build customized/personalized available facets from facets definition
 
 	internalFacets := make(map[string]*solrRequestFacet)
 	requestFacets := make(map[string]*solrRequestFacet)
+	selectedFacets := make(map[string]*solrRequestFacet)
+
+	// when requesting facets for a search, each facet excludes its own filter query (see buildFilters()),
+	// unless records must match all of its selected values, in which case its values are counted
+	// within the current results, since any further selection narrows them.
+	// facets with currently selected values are also requested with all filters applied, so that
+	// any selected values missing from truncated facet lists can be populated later if needed.
+
+	excludeTags := s.virgo.flags.facetCache == false && s.virgo.flags.requestFacets == true
+
+	selectedIDs := make(map[string]bool)
+	for _, filterGroup := range s.virgo.req.Filters {
+		for _, filter := range filterGroup.Facets {
+			selectedIDs[filter.FacetID] = true
+		}
+	}
 
 	auth := s.client.isAuthenticated()
 
@@ -154,27 +374,108 @@ func (s *searchContext) solrInternalRequestFacets() (map[string]*solrRequestFace
 			f.Field = facet.Solr.FieldAuth
 		}
 
+		// range facets either count fixed-size buckets, or a histogram of configured ranges
+		if facet.Type == "range" {
+			f.Sort = ""
+			f.Offset = 0
+			f.Limit = 0
+
+			if len(facet.ComponentQueries) > 0 {
+				f.Type = "query"
+			} else {
+				f.Type = "range"
+				f.Start = facet.Range.solrStart
+				f.End = facet.Range.solrEnd
+				f.Gap = facet.Range.solrGap
+			}
+		}
+
+		// hierarchy facets request the parent field, with the filter's own field nested beneath it
+		if facet.Type == "hierarchy" {
+			child := f
+			child.Type = "terms"
+			child.Offset = 0
+			child.config = nil
+
+			f.Type = "terms"
+			f.Field = facet.Hierarchy.ParentField
+			f.Limit = facet.Hierarchy.ParentLimit
+			f.Facet.Children = &child
+		}
+
 		internalFacets[facet.ID] = &f
 
-		// when iterating over facets, only include current facet in solr request
-		if s.virgo.flags.facetCache == false && s.virgo.flags.requestFacets == true && s.virgo.flags.selectedFacets == false && xid != s.virgo.currentFacet {
+		// the facet as requested, with its own filter excluded if applicable
+		rf := f
+		if excludeTags == true && facet.Match != "all" {
+			rf.Domain = &solrRequestFacetDomain{ExcludeTags: []string{facet.ID}}
+		}
+
+		// a facet page request returns a single facet, although all facets are needed to apply filters
+		if page := s.virgo.facetPage; page != nil {
+			if facet.ID == page.id {
+				rf.Prefix = page.prefix
+				rf.Offset = page.offset
+				rf.Limit = page.limit
+				rf.NumBuckets = true
+				requestFacets[facet.ID] = &rf
+			}
 			continue
 		}
 
-		switch facet.Type {
-		case "component":
+		switch {
+		case len(facet.ComponentQueries) > 0:
 			for _, q := range facet.ComponentQueries {
-				qf := f
+				qf := rf
 				qf.Query = q.Query
 				requestFacets[q.ID] = &qf
+
+				if excludeTags == true && selectedIDs[facet.ID] == true {
+					sf := f
+					sf.Query = q.Query
+					selectedFacets[q.ID] = &sf
+				}
 			}
 
 		default:
-			requestFacets[facet.ID] = &f
+			requestFacets[facet.ID] = &rf
+
+			if excludeTags == true && selectedIDs[facet.ID] == true {
+				sf := f
+				selectedFacets[facet.ID] = &sf
+			}
 		}
 	}
 
-	return internalFacets, requestFacets
+	return internalFacets, requestFacets, selectedFacets
+}
+
+func (s *searchContext) solrRequestExpandedGroups() {
+	// request the top records of each group, sorted by the intra-group sort, along with the
+	// initial (collapsed) record list.  the group head is always the first record of its group.
+
+	sortDef := s.pool.maps.definedSorts[s.virgo.req.Sort.SortID]
+
+	s.solr.req.json.Params.Expand = "true"
+	s.solr.req.json.Params.ExpandRows = fmt.Sprintf("%d", sortDef.GroupRecordLimit-1)
+
+	intraSort := s.intraGroupSort()
+	if intraDef := s.pool.maps.definedSorts[intraSort.SortID]; intraDef != nil {
+		s.solr.req.json.Params.ExpandSort = fmt.Sprintf("%s %s", intraDef.Field, intraSort.Order)
+	}
+
+	// total record count: the same search without collapsing
+
+	if s.solr.req.json.Facets == nil {
+		s.solr.req.json.Facets = make(map[string]*solrRequestFacet)
+	}
+
+	s.solr.req.json.Facets[groupRecordCountFacet] = &solrRequestFacet{
+		Type:   "query",
+		Query:  "*:*",
+		Facet:  solrRequestSubFacet{GroupCount: fmt.Sprintf("unique(%s)", s.pool.config.Local.Solr.GroupField)},
+		Domain: &solrRequestFacetDomain{ExcludeTags: []string{groupCollapseTag}},
+	}
 }
 
 func (s *searchContext) solrRequestWithDefaults() searchResponse {
@@ -182,6 +483,7 @@ func (s *searchContext) solrRequestWithDefaults() searchResponse {
 	s.solr.req.meta.parserInfo = s.virgo.parserInfo
 
 	s.solr.req.meta.selectionMap = make(map[string]map[string]string)
+	s.solr.req.meta.exclusionMap = make(map[string]map[string]string)
 
 	// fill out as much as we can for a generic request
 
@@ -207,8 +509,13 @@ func (s *searchContext) solrRequestWithDefaults() searchResponse {
 		fq = append(fq, s.pool.config.Local.Solr.Params.Fq.Pool...)
 	}
 
+	fq = append(fq, s.virgo.filterQueries...)
+
 	if s.virgo.flags.groupResults == true && s.virgo.flags.requestFacets == false {
-		grouping := fmt.Sprintf("{!collapse field=%s}", s.pool.config.Local.Solr.GroupField)
+		grouping := fmt.Sprintf("{!collapse field=%s}", solrLocalParam(s.pool.config.Local.Solr.GroupField))
+		if s.virgo.flags.expandGroups == true {
+			grouping = fmt.Sprintf("{!collapse tag=%s field=%s}", groupCollapseTag, solrLocalParam(s.pool.config.Local.Solr.GroupField))
+		}
 		fq = append(fq, grouping)
 	}
 
@@ -219,15 +526,40 @@ func (s *searchContext) solrRequestWithDefaults() searchResponse {
 		s.solr.req.json.Params.Sort = fmt.Sprintf("%s %s", s.pool.maps.definedSorts[s.virgo.req.Sort.SortID].Field, s.virgo.req.Sort.Order)
 	}
 
+	// cursor-based paging requires a stable sort on the unique key
+	if s.virgo.cursorMark != "" {
+		s.solr.req.json.Params.CursorMark = s.virgo.cursorMark
+		s.solr.req.json.Params.Sort = fmt.Sprintf("%s asc", s.pool.config.Local.Solr.IdentifierField)
+		s.solr.req.json.Params.Start = 0
+	}
+
 	// add facets/filters
 
-	s.solr.req.meta.internalFacets, s.solr.req.meta.requestFacets = s.solrInternalRequestFacets()
+	s.solr.req.meta.internalFacets, s.solr.req.meta.requestFacets, s.solr.req.meta.selectedFacets = s.solrInternalRequestFacets()
 
 	if s.virgo.flags.requestFacets == true && len(s.solr.req.meta.requestFacets) > 0 {
-		s.solr.req.json.Facets = s.solr.req.meta.requestFacets
+		s.solr.req.json.Facets = make(map[string]*solrRequestFacet)
+
+		for key, val := range s.solr.req.meta.requestFacets {
+			s.solr.req.json.Facets[key] = val
+		}
+
+		for key, val := range s.solr.req.meta.selectedFacets {
+			s.solr.req.json.Facets[selectedFacetPrefix+key] = val
+		}
+	}
+
+	if s.virgo.flags.groupResults == true && s.virgo.flags.requestFacets == false && s.virgo.flags.expandGroups == true {
+		s.solrRequestExpandedGroups()
 	}
 
-	s.solr.req.buildFilters(s, s.virgo.req.Filters, s.solr.req.meta.internalFacets, s.pool.config.Global.Availability)
+	if s.virgo.flags.spellcheck == true {
+		s.solrRequestSpellcheck()
+	}
+
+	if err := s.solr.req.buildFilters(s, s.virgo.req.Filters, s.solr.req.meta.internalFacets, s.pool.config.Global.Availability); err != nil {
+		return searchResponse{status: http.StatusBadRequest, err: err}
+	}
 
 	if s.client.opts.debug == true {
 		s.solr.req.json.Params.DebugQuery = "on"
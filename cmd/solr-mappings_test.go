@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/uvalib/virgo4-api/v4api"
+)
+
+func TestBuildFiltersIsDeterministic(t *testing.T) {
+	// identical filtered requests must marshal to identical solr requests,
+	// as the bytes are used to key both the response cache and in-flight coalescing
+
+	tests := []struct {
+		name    string
+		filters string
+	}{
+		{
+			name: "single group",
+			filters: `[{"pool_id":"test","facets":[
+				{"facet_id":"FilterFormat","value":"Book"},
+				{"facet_id":"FilterFormat","value":"Map"},
+				{"facet_id":"FilterFormat","value":"Journal"},
+				{"facet_id":"FilterLanguage","value":"English"},
+				{"facet_id":"FilterLanguage","value":"-French"},
+				{"facet_id":"FilterLanguage","value":"-German"},
+				{"facet_id":"FilterLibrary","value":"Alderman"},
+				{"facet_id":"FilterLibrary","value":"Clemons"}
+			]}]`,
+		},
+		{
+			name: "multiple groups",
+			filters: `[{"pool_id":"test","facets":[
+				{"facet_id":"FilterFormat","value":"Book"},
+				{"facet_id":"FilterFormat","value":"Map"},
+				{"facet_id":"FilterLanguage","value":"English"}
+			]},{"pool_id":"test","facets":[
+				{"facet_id":"FilterLibrary","value":"Alderman"},
+				{"facet_id":"FilterLibrary","value":"Clemons"},
+				{"facet_id":"FilterLanguage","value":"-French"}
+			]}]`,
+		},
+	}
+
+	internalFacets := map[string]*solrRequestFacet{
+		"FilterFormat":   {Field: "format_f", config: &poolConfigFilter{}},
+		"FilterLanguage": {Field: "language_f", config: &poolConfigFilter{}},
+		"FilterLibrary":  {Field: "library_f", config: &poolConfigFilter{}},
+	}
+
+	ctx := &searchContext{
+		pool:            &poolContext{config: &poolConfig{}},
+		client:          &clientContext{},
+		resourceTypeCtx: &poolConfigResourceTypeContext{},
+	}
+	ctx.virgo.flags.requestFacets = true
+
+	marshal := func(filterGroups []v4api.Filter) []byte {
+		s := solrRequest{}
+		s.meta.client = ctx.client
+		s.meta.selectionMap = make(map[string]map[string]string)
+		s.meta.exclusionMap = make(map[string]map[string]string)
+
+		if err := s.buildFilters(ctx, filterGroups, internalFacets, poolConfigAvailability{}); err != nil {
+			t.Fatalf("buildFilters() failed: %s", err.Error())
+		}
+
+		jsonBytes, err := json.Marshal(s.json)
+		if err != nil {
+			t.Fatalf("Marshal() failed: %s", err.Error())
+		}
+
+		return jsonBytes
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filterGroups []v4api.Filter
+			if err := json.Unmarshal([]byte(tt.filters), &filterGroups); err != nil {
+				t.Fatalf("invalid test filters: %s", err.Error())
+			}
+
+			first := marshal(filterGroups)
+
+			// map iteration order varies between runs, so try several times
+			for i := 0; i < 20; i++ {
+				if next := marshal(filterGroups); bytes.Equal(first, next) == false {
+					t.Fatalf("solr request differs between identical requests:\n%s\n%s", first, next)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildFilterGroupExclusionOnly(t *testing.T) {
+	// excluded values without selected values must still match something once nested
+
+	internalFacets := map[string]*solrRequestFacet{
+		"FilterLanguage": {Field: "language_f", config: &poolConfigFilter{}},
+	}
+
+	ctx := &searchContext{
+		pool:            &poolContext{config: &poolConfig{}},
+		client:          &clientContext{},
+		resourceTypeCtx: &poolConfigResourceTypeContext{},
+	}
+
+	tests := []struct {
+		name   string
+		filter string
+		want   string
+	}{
+		{
+			name:   "selected only",
+			filter: `{"facets":[{"facet_id":"FilterLanguage","value":"English"}]}`,
+			want:   `((language_f:"English"))`,
+		},
+		{
+			name:   "selected and excluded",
+			filter: `{"facets":[{"facet_id":"FilterLanguage","value":"English"},{"facet_id":"FilterLanguage","value":"-French"}]}`,
+			want:   `((language_f:"English")) AND -(language_f:"French")`,
+		},
+		{
+			name:   "excluded only",
+			filter: `{"facets":[{"facet_id":"FilterLanguage","value":"-German"},{"facet_id":"FilterLanguage","value":"-French"}]}`,
+			want:   `*:* AND -(language_f:"French") AND -(language_f:"German")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filterGroup v4api.Filter
+			if err := json.Unmarshal([]byte(tt.filter), &filterGroup); err != nil {
+				t.Fatalf("invalid test filter: %s", err.Error())
+			}
+
+			s := solrRequest{}
+			s.meta.client = ctx.client
+			s.meta.selectionMap = make(map[string]map[string]string)
+			s.meta.exclusionMap = make(map[string]map[string]string)
+
+			filters, err := s.buildFilterGroup(ctx, filterGroup, internalFacets, poolConfigAvailability{})
+			if err != nil {
+				t.Fatalf("buildFilterGroup() failed: %s", err.Error())
+			}
+
+			if got := filters["FilterLanguage"]; got != tt.want {
+				t.Errorf("got [%s], want [%s]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterValueMarkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		bare     string
+		excluded bool
+		invalid  bool
+	}{
+		{name: "selected", value: "Law Library", bare: "Law Library"},
+		{name: "excluded", value: "-Law Library", bare: "Law Library", excluded: true},
+		{name: "selected leading prefix", value: `\-1 to 5`, bare: "-1 to 5"},
+		{name: "excluded leading prefix", value: `-\-1 to 5`, bare: "-1 to 5", excluded: true},
+		{name: "selected leading escape", value: `\\share`, bare: `\share`},
+		{name: "excluded leading escape", value: `-\\share`, bare: `\share`, excluded: true},
+		{name: "embedded prefix", value: "Pre-1900", bare: "Pre-1900"},
+		{name: "former prefix", value: "NOT Available", bare: "NOT Available"},
+		{name: "literal escape", value: `\share`, bare: `\share`},
+		{name: "excluded literal escape", value: `-\share`, bare: `\share`, excluded: true},
+		{name: "unc path", value: `\\server\share`, bare: `\server\share`},
+		{name: "unescaped unc path", value: `\server\share`, bare: `\server\share`},
+		{name: "excluded unc path", value: `-\\server\share`, bare: `\server\share`, excluded: true},
+		{name: "excluded nothing", value: "-", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFilterValueMarker(tt.value)
+
+			if tt.invalid == true {
+				if err == nil {
+					t.Errorf("expected [%s] to be rejected", tt.value)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error for [%s]: %s", tt.value, err.Error())
+			}
+
+			bare, excluded := excludedFilterValue(tt.value)
+			if bare != tt.bare || excluded != tt.excluded {
+				t.Errorf("got [%s] (excluded: %v), want [%s] (excluded: %v)", bare, excluded, tt.bare, tt.excluded)
+			}
+
+			// literal escapes are marked unambiguously, so compare what the marked value means
+			marked := markedFilterValue(bare, excluded)
+			if rebare, reexcluded := excludedFilterValue(marked); rebare != bare || reexcluded != excluded {
+				t.Errorf("marked value [%s] does not round trip to [%s] (excluded: %v)", marked, bare, excluded)
+			}
+		})
+	}
+}
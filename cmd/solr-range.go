@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// range filters: values use solr-like range syntax, with "[" and "]" marking inclusive bounds,
+// "{" and "}" marking exclusive bounds, and "*" marking an open bound.  brackets may be omitted,
+// in which case both bounds are inclusive.  e.g. "1850 TO 1900", "[1850 TO 1900}", "* TO 1900".
+//
+// bounds are numbers, or for date ranges, a year ("1850"), month ("1850-06"), day ("1850-06-15"),
+// or timestamp ("1850-06-15T12:00:00Z").  partial dates cover the whole period they name, so
+// "1850 TO 1900" on a date field includes all of 1900.
+
+var rangeValueRegex = regexp.MustCompile(`^\s*([\[{]?)\s*([^\s\[{]+)\s+TO\s+([^\s\]}]+)\s*([\]}]?)\s*$`)
+
+// date gaps are restricted to whole years, so that buckets can be described by year ranges
+var rangeYearGapRegex = regexp.MustCompile(`^\+?([0-9]+)YEARS?$`)
+
+const rangeOpenBound = "*"
+
+const solrDateFormat = "2006-01-02T15:04:05Z"
+
+type rangeDateLayout struct {
+	layout string
+	unit   string // solr date math unit covered by a bound in this layout
+}
+
+var rangeDateLayouts = []rangeDateLayout{
+	{layout: "2006", unit: "YEAR"},
+	{layout: "2006-01", unit: "MONTH"},
+	{layout: "2006-01-02", unit: "DAY"},
+	{layout: time.RFC3339, unit: ""},
+}
+
+type rangeValue struct {
+	low           string
+	high          string
+	lowInclusive  bool
+	highInclusive bool
+}
+
+func parseRangeValue(value string) (rangeValue, error) {
+	m := rangeValueRegex.FindStringSubmatch(value)
+	if m == nil {
+		return rangeValue{}, fmt.Errorf("malformed range: [%s]", value)
+	}
+
+	r := rangeValue{
+		low:           m[2],
+		high:          m[3],
+		lowInclusive:  m[1] != "{",
+		highInclusive: m[4] != "}",
+	}
+
+	return r, nil
+}
+
+func (r rangeValue) String() string {
+	// canonical form, used to match selected values to facet buckets
+
+	open := "["
+	if r.lowInclusive == false {
+		open = "{"
+	}
+
+	close := "]"
+	if r.highInclusive == false {
+		close = "}"
+	}
+
+	return fmt.Sprintf("%s%s TO %s%s", open, r.low, r.high, close)
+}
+
+func parseRangeNumber(bound string) (float64, error) {
+	n, err := strconv.ParseFloat(bound, 64)
+	if err != nil || math.IsNaN(n) == true || math.IsInf(n, 0) == true {
+		return 0, fmt.Errorf("invalid number: [%s]", bound)
+	}
+
+	return n, nil
+}
+
+func parseRangeDate(bound string) (time.Time, string, error) {
+	// returns the start of the period named by the bound, and the solr date math unit it spans
+
+	for _, l := range rangeDateLayouts {
+		if t, err := time.Parse(l.layout, bound); err == nil {
+			return t.UTC(), l.unit, nil
+		}
+	}
+
+	return time.Time{}, "", fmt.Errorf("invalid date: [%s]", bound)
+}
+
+func solrRangeDate(bound string, upper bool, inclusive bool) (string, bool, error) {
+	// converts a date bound to a solr date (possibly with date math), and whether it is inclusive
+
+	if bound == rangeOpenBound {
+		return bound, true, nil
+	}
+
+	t, unit, err := parseRangeDate(bound)
+	if err != nil {
+		return "", false, err
+	}
+
+	date := t.Format(solrDateFormat)
+
+	if unit == "" {
+		return date, inclusive, nil
+	}
+
+	// a partial date included as an upper bound, or excluded as a lower bound,
+	// extends to (but excludes) the start of the next period
+
+	if upper == inclusive {
+		return fmt.Sprintf("%s+1%s", date, unit), upper == false, nil
+	}
+
+	return date, inclusive, nil
+}
+
+func (r rangeValue) validate(valueType string) error {
+	switch valueType {
+	case "date":
+		var low, high time.Time
+		var err error
+
+		if r.low != rangeOpenBound {
+			if low, _, err = parseRangeDate(r.low); err != nil {
+				return err
+			}
+		}
+
+		if r.high != rangeOpenBound {
+			if high, _, err = parseRangeDate(r.high); err != nil {
+				return err
+			}
+		}
+
+		if r.low != rangeOpenBound && r.high != rangeOpenBound && low.After(high) == true {
+			return fmt.Errorf("range start is after range end: [%s]", r.String())
+		}
+
+	default:
+		var low, high float64
+		var err error
+
+		if r.low != rangeOpenBound {
+			if low, err = parseRangeNumber(r.low); err != nil {
+				return err
+			}
+		}
+
+		if r.high != rangeOpenBound {
+			if high, err = parseRangeNumber(r.high); err != nil {
+				return err
+			}
+		}
+
+		if r.low != rangeOpenBound && r.high != rangeOpenBound && low > high {
+			return fmt.Errorf("range start is after range end: [%s]", r.String())
+		}
+	}
+
+	return nil
+}
+
+func (r rangeValue) solrRange(valueType string) (string, error) {
+	// returns the range as a solr range query term, e.g. "[1850 TO 1900]"
+
+	if err := r.validate(valueType); err != nil {
+		return "", err
+	}
+
+	low := r.low
+	high := r.high
+	lowInclusive := r.lowInclusive
+	highInclusive := r.highInclusive
+
+	if valueType == "date" {
+		low, lowInclusive, _ = solrRangeDate(r.low, false, r.lowInclusive)
+		high, highInclusive, _ = solrRangeDate(r.high, true, r.highInclusive)
+	}
+
+	return rangeValue{low: low, high: high, lowInclusive: lowInclusive, highInclusive: highInclusive}.String(), nil
+}
+
+func solrRangeFilter(field string, valueType string, value string) (string, string, error) {
+	// returns the canonical range value and its solr filter query
+
+	r, err := parseRangeValue(value)
+	if err != nil {
+		return "", "", err
+	}
+
+	solrRange, err := r.solrRange(valueType)
+	if err != nil {
+		return "", "", err
+	}
+
+	return r.String(), fmt.Sprintf("%s:%s", field, solrRange), nil
+}
+
+func (def *poolConfigFilter) initRange() error {
+	// validates the bucket configuration for a range filter, and converts it to solr form
+
+	c := &def.Range
+
+	// buckets are counted on a single field, regardless of client authentication
+	if def.Solr.FieldAuth != "" {
+		return fmt.Errorf("range filters do not support field_auth")
+	}
+
+	switch c.ValueType {
+	case "", "number", "date":
+	default:
+		return fmt.Errorf("unrecognized value type: [%s]", c.ValueType)
+	}
+
+	if (c.Gap == "") == (len(c.Ranges) == 0) {
+		return fmt.Errorf("exactly one of gap or ranges must be configured")
+	}
+
+	if c.Gap != "" {
+		bounds := rangeValue{low: c.Start, high: c.End, lowInclusive: true, highInclusive: false}
+
+		if c.Start == "" || c.End == "" || c.Start == rangeOpenBound || c.End == rangeOpenBound {
+			return fmt.Errorf("start and end are required with gap")
+		}
+
+		if err := bounds.validate(c.ValueType); err != nil {
+			return err
+		}
+
+		c.solrStart = c.Start
+		c.solrEnd = c.End
+		c.solrGap = c.Gap
+
+		switch c.ValueType {
+		case "date":
+			m := rangeYearGapRegex.FindStringSubmatch(c.Gap)
+			if m == nil {
+				return fmt.Errorf("date gap must be a number of years, e.g. +10YEARS: [%s]", c.Gap)
+			}
+
+			c.gapYears, _ = strconv.Atoi(m[1])
+			c.solrGap = fmt.Sprintf("+%dYEARS", c.gapYears)
+			c.solrStart, _, _ = solrRangeDate(c.Start, false, true)
+			c.solrEnd, _, _ = solrRangeDate(c.End, false, true)
+
+		default:
+			gap, err := parseRangeNumber(c.Gap)
+			if err != nil {
+				return err
+			}
+
+			c.gapNumber = gap
+		}
+
+		if c.gapYears <= 0 && c.gapNumber <= 0 {
+			return fmt.Errorf("gap must be positive: [%s]", c.Gap)
+		}
+	}
+
+	// histogram ranges are requested as component queries, named by their canonical range value
+
+	if len(c.Ranges) > 0 {
+		def.ComponentQueries = nil
+	}
+
+	for i, val := range c.Ranges {
+		canonical, query, err := solrRangeFilter(def.Solr.Field, c.ValueType, val)
+		if err != nil {
+			return fmt.Errorf("range %d: %s", i, err.Error())
+		}
+
+		q := poolConfigFacetQuery{
+			ID:    fmt.Sprintf("%s_range_%d", def.ID, i),
+			Name:  canonical,
+			Query: query,
+		}
+
+		def.ComponentQueries = append(def.ComponentQueries, q)
+	}
+
+	return nil
+}
+
+func (c *poolConfigFilterRange) bucketValue(val string) string {
+	// returns the canonical range value of a fixed-gap bucket, given its starting value from solr
+
+	switch c.ValueType {
+	case "date":
+		t, err := time.Parse(solrDateFormat, val)
+		if err != nil {
+			return ""
+		}
+
+		return rangeValue{
+			low:           strconv.Itoa(t.Year()),
+			high:          strconv.Itoa(t.Year() + c.gapYears),
+			lowInclusive:  true,
+			highInclusive: false,
+		}.String()
+
+	default:
+		low, err := parseRangeNumber(val)
+		if err != nil {
+			return ""
+		}
+
+		return rangeValue{
+			low:           strconv.FormatFloat(low, 'f', -1, 64),
+			high:          strconv.FormatFloat(low+c.gapNumber, 'f', -1, 64),
+			lowInclusive:  true,
+			highInclusive: false,
+		}.String()
+	}
+}
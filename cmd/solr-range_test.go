@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSolrRangeFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		valueType string
+		value     string
+		canonical string
+		filter    string
+		invalid   bool
+	}{
+		// numbers
+		{name: "number", valueType: "number", value: "1850 TO 1900", canonical: "[1850 TO 1900]", filter: "f:[1850 TO 1900]"},
+		{name: "default type", valueType: "", value: "1850 TO 1900", canonical: "[1850 TO 1900]", filter: "f:[1850 TO 1900]"},
+		{name: "exclusive bounds", valueType: "number", value: "{1850 TO 1900}", canonical: "{1850 TO 1900}", filter: "f:{1850 TO 1900}"},
+		{name: "mixed bounds", valueType: "number", value: "[1.5 TO 2.5}", canonical: "[1.5 TO 2.5}", filter: "f:[1.5 TO 2.5}"},
+		{name: "negative", valueType: "number", value: "-10 TO -5", canonical: "[-10 TO -5]", filter: "f:[-10 TO -5]"},
+		{name: "surrounding whitespace", valueType: "number", value: "  [ 1850  TO 1900 ]  ", canonical: "[1850 TO 1900]", filter: "f:[1850 TO 1900]"},
+		{name: "open start", valueType: "number", value: "* TO 1900", canonical: "[* TO 1900]", filter: "f:[* TO 1900]"},
+		{name: "open end", valueType: "number", value: "1850 TO *", canonical: "[1850 TO *]", filter: "f:[1850 TO *]"},
+		{name: "open both", valueType: "number", value: "* TO *", canonical: "[* TO *]", filter: "f:[* TO *]"},
+		{name: "single point", valueType: "number", value: "1900 TO 1900", canonical: "[1900 TO 1900]", filter: "f:[1900 TO 1900]"},
+		{name: "reversed", valueType: "number", value: "1900 TO 1850", invalid: true},
+		{name: "not a number", valueType: "number", value: "abc TO 5", invalid: true},
+		{name: "nan", valueType: "number", value: "NaN TO 5", invalid: true},
+		{name: "infinity", valueType: "number", value: "1 TO Inf", invalid: true},
+		{name: "missing bound", valueType: "number", value: "[1850 TO]", invalid: true},
+		{name: "missing separator", valueType: "number", value: "1850-1900", invalid: true},
+		{name: "lowercase separator", valueType: "number", value: "1850 to 1900", invalid: true},
+		{name: "empty", valueType: "number", value: "", invalid: true},
+		{name: "query injection", valueType: "number", value: "1 TO 2] OR id:*", invalid: true},
+
+		// dates: partial dates cover the whole period they name, via date math
+		{name: "years", valueType: "date", value: "1850 TO 1900", canonical: "[1850 TO 1900]", filter: "f:[1850-01-01T00:00:00Z TO 1900-01-01T00:00:00Z+1YEAR}"},
+		{name: "exclusive years", valueType: "date", value: "{1850 TO 1900}", canonical: "{1850 TO 1900}", filter: "f:[1850-01-01T00:00:00Z+1YEAR TO 1900-01-01T00:00:00Z}"},
+		{name: "months", valueType: "date", value: "1850-06 TO 1850-07", canonical: "[1850-06 TO 1850-07]", filter: "f:[1850-06-01T00:00:00Z TO 1850-07-01T00:00:00Z+1MONTH}"},
+		{name: "days", valueType: "date", value: "1850-06-15 TO 1850-06-15", canonical: "[1850-06-15 TO 1850-06-15]", filter: "f:[1850-06-15T00:00:00Z TO 1850-06-15T00:00:00Z+1DAY}"},
+		{name: "timestamps", valueType: "date", value: "1850-06-15T12:00:00Z TO 1850-06-16T00:00:00Z}", canonical: "[1850-06-15T12:00:00Z TO 1850-06-16T00:00:00Z}", filter: "f:[1850-06-15T12:00:00Z TO 1850-06-16T00:00:00Z}"},
+		{name: "open date start", valueType: "date", value: "* TO 1900", canonical: "[* TO 1900]", filter: "f:[* TO 1900-01-01T00:00:00Z+1YEAR}"},
+		{name: "open date end", valueType: "date", value: "1850 TO *", canonical: "[1850 TO *]", filter: "f:[1850-01-01T00:00:00Z TO *]"},
+		{name: "reversed dates", valueType: "date", value: "1900 TO 1850", invalid: true},
+		{name: "invalid month", valueType: "date", value: "1850-13 TO 1900", invalid: true},
+		{name: "invalid day", valueType: "date", value: "1850-02-30 TO 1900", invalid: true},
+		{name: "solr date math", valueType: "date", value: "NOW-10YEARS TO NOW", invalid: true},
+		{name: "number as date", valueType: "date", value: "1.5 TO 2", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canonical, filter, err := solrRangeFilter("f", tt.valueType, tt.value)
+
+			if tt.invalid == true {
+				if err == nil {
+					t.Errorf("expected [%s] to be rejected, got [%s]", tt.value, filter)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error for [%s]: %s", tt.value, err.Error())
+			}
+
+			if canonical != tt.canonical {
+				t.Errorf("canonical: got [%s], want [%s]", canonical, tt.canonical)
+			}
+
+			if filter != tt.filter {
+				t.Errorf("filter: got [%s], want [%s]", filter, tt.filter)
+			}
+		})
+	}
+}
+
+func TestRangeBucketValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   poolConfigFilterRange
+		value string
+		want  string
+	}{
+		{name: "date", cfg: poolConfigFilterRange{ValueType: "date", gapYears: 10}, value: "1850-01-01T00:00:00Z", want: "[1850 TO 1860}"},
+		{name: "number", cfg: poolConfigFilterRange{ValueType: "number", gapNumber: 2.5}, value: "10", want: "[10 TO 12.5}"},
+		{name: "invalid date", cfg: poolConfigFilterRange{ValueType: "date", gapYears: 10}, value: "1850", want: ""},
+		{name: "invalid number", cfg: poolConfigFilterRange{ValueType: "number", gapNumber: 1}, value: "x", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.bucketValue(tt.value); got != tt.want {
+				t.Errorf("got [%s], want [%s]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     poolConfigFilterRange
+		invalid bool
+	}{
+		{name: "number gap", cfg: poolConfigFilterRange{ValueType: "number", Start: "0", End: "100", Gap: "10"}},
+		{name: "date gap", cfg: poolConfigFilterRange{ValueType: "date", Start: "1800", End: "2000", Gap: "+10YEARS"}},
+		{name: "ranges", cfg: poolConfigFilterRange{ValueType: "date", Ranges: []string{"* TO 1800", "1801 TO 1900", "1901 TO *"}}},
+		{name: "gap and ranges", cfg: poolConfigFilterRange{Start: "0", End: "100", Gap: "10", Ranges: []string{"0 TO 5"}}, invalid: true},
+		{name: "neither gap nor ranges", cfg: poolConfigFilterRange{}, invalid: true},
+		{name: "open gap end", cfg: poolConfigFilterRange{Start: "0", End: "*", Gap: "10"}, invalid: true},
+		{name: "reversed gap bounds", cfg: poolConfigFilterRange{Start: "100", End: "0", Gap: "10"}, invalid: true},
+		{name: "zero gap", cfg: poolConfigFilterRange{Start: "0", End: "100", Gap: "0"}, invalid: true},
+		{name: "date gap in months", cfg: poolConfigFilterRange{ValueType: "date", Start: "1800", End: "2000", Gap: "+1MONTH"}, invalid: true},
+		{name: "invalid range", cfg: poolConfigFilterRange{Ranges: []string{"1 TO 2", "x TO 3"}}, invalid: true},
+		{name: "unknown value type", cfg: poolConfigFilterRange{ValueType: "time", Ranges: []string{"1 TO 2"}}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := poolConfigFilter{ID: "FilterRange", Range: tt.cfg}
+			def.Solr.Field = "f"
+
+			err := def.initRange()
+
+			if tt.invalid == true && err == nil {
+				t.Errorf("expected range configuration to be rejected")
+			}
+
+			if tt.invalid == false && err != nil {
+				t.Errorf("unexpected error: %s", err.Error())
+			}
+		})
+	}
+}
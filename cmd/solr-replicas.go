@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// a single solr replica, with its own clients and circuit breaker.
+// replicas are taken out of rotation after repeated failed pings,
+// and put back into rotation once a ping succeeds again.
+
+type solrReplica struct {
+	host         string
+	service      httpClientContext
+	healthCheck  httpClientContext
+	indexVersion httpClientContext
+	breaker      *circuitBreaker
+	mu           sync.Mutex
+	inRotation   bool
+	failedPings  int
+	lastError    string
+}
+
+type solrReplicaStatus struct {
+	host        string
+	inRotation  bool
+	failedPings int
+	lastError   string
+	breaker     circuitBreakerStatus
+}
+
+func (p *poolContext) solrHosts() []string {
+	// the replica list takes precedence over the single host setting
+	var hosts []string
+
+	for _, host := range p.config.Local.Solr.Hosts {
+		if host = strings.TrimRight(strings.TrimSpace(host), "/"); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	if len(hosts) == 0 && p.config.Local.Solr.Host != "" {
+		hosts = append(hosts, strings.TrimRight(p.config.Local.Solr.Host, "/"))
+	}
+
+	return hosts
+}
+
+func newSolrReplica(host string, cfg poolConfigSolr) *solrReplica {
+	// the service and health check clients share a circuit breaker, since they talk to the same host
+	breaker := newCircuitBreaker(host, cfg.Clients.Service.CircuitBreaker)
+
+	r := solrReplica{
+		host:       host,
+		breaker:    breaker,
+		inRotation: true,
+	}
+
+	r.service = httpClientContext{
+		url:     fmt.Sprintf("%s/%s/%s", host, cfg.Core, cfg.Clients.Service.Endpoint),
+		client:  httpClientWithTimeouts(cfg.Clients.Service.ConnTimeout, cfg.Clients.Service.ReadTimeout),
+		retry:   newRetryPolicy(cfg.Clients.Service.Retry),
+		breaker: breaker,
+	}
+
+	r.healthCheck = httpClientContext{
+		url:     fmt.Sprintf("%s/%s/%s", host, cfg.Core, cfg.Clients.HealthCheck.Endpoint),
+		client:  httpClientWithTimeouts(cfg.Clients.HealthCheck.ConnTimeout, cfg.Clients.HealthCheck.ReadTimeout),
+		breaker: breaker,
+	}
+
+	r.indexVersion = httpClientContext{
+		url:     fmt.Sprintf("%s/%s/%s", host, cfg.Core, cfg.Cache.VersionEndpoint),
+		client:  httpClientWithTimeouts(cfg.Clients.HealthCheck.ConnTimeout, cfg.Clients.HealthCheck.ReadTimeout),
+		breaker: breaker,
+	}
+
+	return &r
+}
+
+func (r *solrReplica) isInRotation() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.inRotation
+}
+
+func (r *solrReplica) recordPing(err error, maxFailures int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err == nil {
+		if r.inRotation == false {
+			log.Printf("[SOLR] replica %s: ping succeeded; returning to rotation", r.host)
+		}
+
+		r.inRotation = true
+		r.failedPings = 0
+		r.lastError = ""
+
+		return
+	}
+
+	r.failedPings++
+	r.lastError = err.Error()
+
+	if r.inRotation == true && r.failedPings >= maxFailures {
+		log.Printf("[SOLR] replica %s: %d consecutive failed pings; removing from rotation", r.host, r.failedPings)
+		r.inRotation = false
+	}
+}
+
+func (r *solrReplica) status() solrReplicaStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return solrReplicaStatus{
+		host:        r.host,
+		inRotation:  r.inRotation,
+		failedPings: r.failedPings,
+		lastError:   r.lastError,
+		breaker:     r.breaker.status(),
+	}
+}
+
+func (p *poolSolr) replicasForRequest() []*solrReplica {
+	// returns all replicas in the order they should be tried: in-rotation replicas first,
+	// starting from the next one in round-robin order, followed by any out-of-rotation
+	// replicas as a last resort
+
+	n := len(p.replicas)
+	start := int(p.nextReplica.Add(1) % uint64(n))
+
+	var active, inactive []*solrReplica
+
+	for i := 0; i < n; i++ {
+		r := p.replicas[(start+i)%n]
+
+		if r.isInRotation() == true {
+			active = append(active, r)
+		} else {
+			inactive = append(inactive, r)
+		}
+	}
+
+	return append(active, inactive...)
+}
+
+func (p *poolContext) monitorSolrReplicas(interval int, maxFailures int) {
+	c := clientContext{}
+	c.init(p, nil)
+	c.reqID = "solr-replica-monitor"
+
+	for {
+		if p.wait(interval) == false {
+			return
+		}
+
+		for _, r := range p.solr.replicas {
+			s := searchContext{}
+			s.init(p, &c)
+			s.virgo.endpoint = "ping"
+
+			r.recordPing(s.solrPing(r), maxFailures)
+		}
+	}
+}
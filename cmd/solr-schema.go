@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// configured solr fields can be cross-checked against the core's schema, as retrieved from
+// solr's schema api (GET <core>/schema), or from a saved copy of that response for offline
+// checks.  field properties not set on a field are inherited from its field type, and
+// otherwise take solr's defaults.
+
+const defaultSolrSchemaEndpoint = "schema"
+
+// plain field names; anything else in a field list (globs, functions, transformers) is not checked
+var solrFieldNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// names that may appear where fields do, but are not defined in the schema
+var solrPseudoFields = []string{"score", "_docid_"}
+
+type solrFieldRequirement int
+
+const (
+	solrFieldExists     solrFieldRequirement = iota
+	solrFieldSearchable                      // usable for faceting or sorting: indexed or docValues
+	solrFieldStored                          // usable for highlighting
+	solrFieldSimilarity                      // usable for more like this: termVectors or stored
+)
+
+type solrSchemaProperties struct {
+	Indexed     *bool `json:"indexed,omitempty"`
+	Stored      *bool `json:"stored,omitempty"`
+	DocValues   *bool `json:"docValues,omitempty"`
+	TermVectors *bool `json:"termVectors,omitempty"`
+}
+
+type solrSchemaField struct {
+	solrSchemaProperties
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type solrSchemaFieldType struct {
+	solrSchemaProperties
+	Name  string `json:"name"`
+	Class string `json:"class"`
+}
+
+type solrSchemaResponse struct {
+	Schema struct {
+		Fields        []solrSchemaField     `json:"fields"`
+		DynamicFields []solrSchemaField     `json:"dynamicFields"`
+		FieldTypes    []solrSchemaFieldType `json:"fieldTypes"`
+	} `json:"schema"`
+}
+
+type solrSchema struct {
+	fields        map[string]*solrSchemaField
+	dynamicFields []*solrSchemaField // longest patterns first, as solr matches them
+	fieldTypes    map[string]*solrSchemaFieldType
+}
+
+func newSolrSchema(res *solrSchemaResponse) *solrSchema {
+	s := solrSchema{
+		fields:     make(map[string]*solrSchemaField),
+		fieldTypes: make(map[string]*solrSchemaFieldType),
+	}
+
+	for i := range res.Schema.Fields {
+		f := &res.Schema.Fields[i]
+		s.fields[f.Name] = f
+	}
+
+	for i := range res.Schema.DynamicFields {
+		s.dynamicFields = append(s.dynamicFields, &res.Schema.DynamicFields[i])
+	}
+
+	sort.SliceStable(s.dynamicFields, func(i, j int) bool {
+		return len(s.dynamicFields[i].Name) > len(s.dynamicFields[j].Name)
+	})
+
+	for i := range res.Schema.FieldTypes {
+		t := &res.Schema.FieldTypes[i]
+		s.fieldTypes[t.Name] = t
+	}
+
+	return &s
+}
+
+func (s *solrSchema) field(name string) *solrSchemaField {
+	if f := s.fields[name]; f != nil {
+		return f
+	}
+
+	for _, f := range s.dynamicFields {
+		pattern := f.Name
+
+		switch {
+		case pattern == "*":
+			return f
+
+		case strings.HasPrefix(pattern, "*") == true:
+			if strings.HasSuffix(name, pattern[1:]) == true {
+				return f
+			}
+
+		case strings.HasSuffix(pattern, "*") == true:
+			if strings.HasPrefix(name, pattern[:len(pattern)-1]) == true {
+				return f
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *solrSchema) property(f *solrSchemaField, value func(solrSchemaProperties) *bool, fallback bool) bool {
+	if v := value(f.solrSchemaProperties); v != nil {
+		return *v
+	}
+
+	if t := s.fieldTypes[f.Type]; t != nil {
+		if v := value(t.solrSchemaProperties); v != nil {
+			return *v
+		}
+	}
+
+	return fallback
+}
+
+func (s *solrSchema) isSearchable(f *solrSchemaField) bool {
+	indexed := s.property(f, func(p solrSchemaProperties) *bool { return p.Indexed }, true)
+	docValues := s.property(f, func(p solrSchemaProperties) *bool { return p.DocValues }, false)
+
+	return indexed == true || docValues == true
+}
+
+func (s *solrSchema) isStored(f *solrSchemaField) bool {
+	return s.property(f, func(p solrSchemaProperties) *bool { return p.Stored }, true)
+}
+
+func (s *solrSchema) hasTermVectors(f *solrSchemaField) bool {
+	return s.property(f, func(p solrSchemaProperties) *bool { return p.TermVectors }, false)
+}
+
+func (p *poolContext) fetchSolrSchema() ([]byte, error) {
+	// any replica will do, as they share a schema
+
+	cfg := p.config.Local.Solr
+
+	endpoint := cfg.Schema.Endpoint
+	if endpoint == "" {
+		endpoint = defaultSolrSchemaEndpoint
+	}
+
+	client := httpClientWithTimeouts(cfg.Clients.Service.ConnTimeout, cfg.Clients.Service.ReadTimeout)
+
+	var lastErr error
+
+	for _, host := range p.solrHosts() {
+		url := fmt.Sprintf("%s/%s/%s", host, cfg.Core, endpoint)
+
+		res, err := client.Get(url)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("%s: unexpected status: %d", url, res.StatusCode)
+			continue
+		}
+
+		log.Printf("[SCHEMA] retrieved solr schema from %s", url)
+
+		return body, nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no solr hosts")
+	}
+
+	return nil, lastErr
+}
+
+func (p *poolContext) initSolrSchema() error {
+	cfg := &p.config.Local.Solr.Schema
+
+	if cfg.Check == false && cfg.File == "" {
+		return nil
+	}
+
+	var body []byte
+	var err error
+
+	if cfg.File != "" {
+		log.Printf("[SCHEMA] loading solr schema from %s", cfg.File)
+		body, err = os.ReadFile(cfg.File)
+	} else {
+		body, err = p.fetchSolrSchema()
+	}
+
+	if err == nil {
+		var res solrSchemaResponse
+
+		if err = json.Unmarshal(body, &res); err == nil && len(res.Schema.Fields) == 0 {
+			err = fmt.Errorf("no fields found in schema")
+		}
+
+		if err == nil {
+			p.solr.schema = newSolrSchema(&res)
+			return nil
+		}
+	}
+
+	// an unreachable solr should not prevent startup, as it may just be temporarily down.
+	// an unusable schema file, or any failure when explicitly validating, is a problem though.
+
+	if cfg.File == "" && p.validateOnly == false {
+		log.Printf("[SCHEMA] WARNING: unable to retrieve solr schema; skipping field checks: %s", err.Error())
+		return nil
+	}
+
+	p.configProblem(cfg, "[SCHEMA] unable to load solr schema: %s", err.Error())
+
+	return fmt.Errorf("invalid solr schema configuration")
+}
+
+func (v *stringValidator) checkSolrField(value *string, label string, require solrFieldRequirement) {
+	// with a schema, verifies that the field exists and supports how it is used
+
+	if v.schema == nil || solrFieldNameRegex.MatchString(*value) == false || sliceContainsString(solrPseudoFields, *value, false) == true {
+		return
+	}
+
+	f := v.schema.field(*value)
+
+	var problem string
+
+	switch {
+	case f == nil:
+		problem = "not found in solr schema"
+
+	case require == solrFieldSearchable && v.schema.isSearchable(f) == false:
+		problem = "is neither indexed nor docValues in solr schema"
+
+	case require == solrFieldStored && v.schema.isStored(f) == false:
+		problem = "is not stored in solr schema"
+
+	case require == solrFieldSimilarity && v.schema.hasTermVectors(f) == false && v.schema.isStored(f) == false:
+		problem = "has neither termVectors nor is stored in solr schema"
+
+	default:
+		return
+	}
+
+	v.pool.configProblem(v.location(value), "[VALIDATE] %s%s [%s] %s%s", v.prefix, label, *value, problem, v.postfix)
+	v.invalid = true
+}
+
+func (p *poolContext) validateSolrFieldUsage(v *stringValidator) {
+	// existence of most fields is checked as they are required; this checks fields that must
+	// also support a particular use, and any that are otherwise unchecked
+
+	if v.schema == nil {
+		return
+	}
+
+	for xid, val := range p.maps.definedFilters {
+		v.checkSolrField(&val.Solr.Field, fmt.Sprintf("filter [%s] solr field", xid), solrFieldSearchable)
+		v.checkSolrField(&val.Solr.FieldAuth, fmt.Sprintf("filter [%s] solr auth field", xid), solrFieldSearchable)
+		v.checkSolrField(&val.Hierarchy.ParentField, fmt.Sprintf("filter [%s] hierarchy parent field", xid), solrFieldSearchable)
+	}
+
+	for i, val := range p.sorts {
+		// relevance sorts are on score, which is not a field
+		if val.IsRelevance == true {
+			continue
+		}
+
+		v.checkSolrField(&val.Field, fmt.Sprintf("sort option %d group field", i), solrFieldSearchable)
+	}
+
+	for i := range p.config.Local.Solr.Params.Fl {
+		v.checkSolrField(&p.config.Local.Solr.Params.Fl[i], "solr param fl field", solrFieldExists)
+	}
+
+	for i := range p.config.Local.Solr.Highlighting.Fl {
+		v.checkSolrField(&p.config.Local.Solr.Highlighting.Fl[i], "solr highlighting fl field", solrFieldStored)
+	}
+
+	// more like this analyzes the terms of each field, from term vectors or stored values
+	for i := range p.config.Local.Solr.MoreLikeThis.Fields {
+		v.checkSolrField(&p.config.Local.Solr.MoreLikeThis.Fields[i], fmt.Sprintf("more like this field %d", i), solrFieldSimilarity)
+	}
+
+	// suggestions are drawn from indexed terms
+	for i := range p.resourceTypeContexts {
+		r := p.resourceTypeContexts[i]
+
+		for j := range r.Suggestions {
+			v.checkSolrField(&r.Suggestions[j].Dictionary, fmt.Sprintf("resource type %d [%s] suggestion %d dictionary", i, r.Value, j), solrFieldSearchable)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -38,6 +39,8 @@ func (s *searchContext) convertFacets() error {
 		Result:     &facets,
 		TagName:    "json",
 		ZeroFields: true,
+		// numeric range facet bucket values are decoded as strings
+		WeaklyTypedInput: true,
 	}
 
 	dec, _ := mapstructure.NewDecoder(cfg)
@@ -98,8 +101,6 @@ func (s *searchContext) populateMetaFields() {
 }
 
 func (s *searchContext) solrQuery() error {
-	ctx := s.pool.solr.service
-
 	s.solr.res = solrResponse{}
 
 	if s.virgo.skipQuery == true {
@@ -108,25 +109,40 @@ func (s *searchContext) solrQuery() error {
 		return nil
 	}
 
+	if err := s.requestAbandoned(); err != nil {
+		s.log("SOLR: not issuing query: %s", err.Error())
+		return err
+	}
+
 	jsonBytes, jsonErr := json.Marshal(s.solr.req.json)
 	if jsonErr != nil {
 		s.log("SOLR: Marshal() failed: %s", jsonErr.Error())
 		return fmt.Errorf("failed to marshal Solr JSON")
 	}
 
-	// we cannot use query parameters for the request due to the
-	// possibility of triggering a 414 response (URI Too Long).
+	// serve from the response cache, if possible
 
-	// instead, write the json to the body of the request.
-	// NOTE: Solr is lenient; GET or POST works fine for this.
+	cache := s.pool.solr.cache
 
-	req, reqErr := http.NewRequest("POST", ctx.url, bytes.NewBuffer(jsonBytes))
-	if reqErr != nil {
-		s.log("SOLR: NewRequest() failed: %s", reqErr.Error())
-		return fmt.Errorf("failed to create Solr request")
+	// export pages are unlikely to be requested again
+	if s.virgo.cursorMark != "" {
+		cache = nil
 	}
+	key := solrRequestKey(jsonBytes, s.client.claims)
+	cacheVersion := cache.currentVersion()
 
-	req.Header.Set("Content-Type", "application/json")
+	if body, ok := cache.get(key); ok == true {
+		s.log("SOLR: response cache hit")
+
+		if decErr := json.Unmarshal(body, &s.solr.res); decErr != nil {
+			s.log("SOLR: Unmarshal() failed: %s", decErr.Error())
+			return fmt.Errorf("failed to unmarshal cached Solr response")
+		}
+
+		s.solr.req.meta.cacheHit = true
+
+		return s.processSolrResponse()
+	}
 
 	if s.client.opts.verbose == true {
 		s.verbose("SOLR: req: [%s]", string(jsonBytes))
@@ -140,63 +156,139 @@ func (s *searchContext) solrQuery() error {
 		s.log("SOLR: req: [%s]", q)
 	}
 
+	// identical requests already in flight are waited on rather than repeated
+
 	start := time.Now()
-	res, resErr := ctx.client.Do(req)
+	res, shared, fetchErr := s.pool.solr.inflight.do(s.ctx, key, func(ctx context.Context) (solrFetchResult, error) {
+		return s.solrFetch(ctx, jsonBytes)
+	})
 	elapsedMS := int64(time.Since(start) / time.Millisecond)
 
-	// external service failure logging (scenario 1)
+	if fetchErr != nil {
+		return fetchErr
+	}
 
-	if resErr != nil {
-		status := http.StatusBadRequest
-		errMsg := resErr.Error()
-		if strings.Contains(errMsg, "Timeout") {
-			status = http.StatusRequestTimeout
-			errMsg = fmt.Sprintf("%s timed out", ctx.url)
-		} else if strings.Contains(errMsg, "connection refused") {
-			status = http.StatusServiceUnavailable
-			errMsg = fmt.Sprintf("%s refused connection", ctx.url)
-		}
+	if shared == true {
+		s.log("SOLR: response shared with identical in-flight request")
+	}
 
-		s.log("SOLR: client.Do() failed: %s", resErr.Error())
-		s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, status, errMsg, elapsedMS)
-		return fmt.Errorf("failed to receive Solr response")
+	if s.client.opts.verbose == true {
+		s.verbose("SOLR: res: [%s]", res.body)
 	}
 
-	defer res.Body.Close()
+	// external service failure logging (scenario 2)
 
-	// verbose response logging requires the entire response body to be read in.
-	// this is memory intensive, but acceptable as it is primarily meant for debugging.
+	if decErr := json.Unmarshal(res.body, &s.solr.res); decErr != nil {
+		s.log("SOLR: Unmarshal() failed: %s", decErr.Error())
+		s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", res.method, res.url, http.StatusInternalServerError, decErr.Error(), elapsedMS)
+		return fmt.Errorf("failed to unmarshal Solr response")
+	}
 
-	if s.client.opts.verbose == true {
-		body, _ := ioutil.ReadAll(res.Body)
+	// external service success logging
 
-		s.verbose("SOLR: res: [%s]", body)
+	s.log("Successful Solr response from %s %s. Elapsed Time: %d (ms)", res.method, res.url, elapsedMS)
 
-		// external service failure logging (scenario 2)
+	s.log("SOLR: endpoint: %-8s  qtime: %5d  elapsed: %5d  overhead: %5d", s.virgo.endpoint, s.solr.res.ResponseHeader.QTime, elapsedMS, elapsedMS-int64(s.solr.res.ResponseHeader.QTime))
 
-		if decErr := json.Unmarshal(body, &s.solr.res); decErr != nil {
-			s.log("SOLR: Unmarshal() failed: %s", decErr.Error())
-			s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, http.StatusInternalServerError, decErr.Error(), elapsedMS)
-			return fmt.Errorf("failed to unmarshal Solr response")
+	if err := s.processSolrResponse(); err != nil {
+		return err
+	}
+
+	// only successful responses are cached
+	if shared == false {
+		cache.put(key, res.body, cacheVersion)
+	}
+
+	return nil
+}
+
+func (s *searchContext) solrFetch(reqCtx context.Context, jsonBytes []byte) (solrFetchResult, error) {
+	// posts the request to solr and returns the raw response body.
+	// the entire body is read in so that it can be shared with any coalesced
+	// requests and cached; it is decoded by each caller.
+
+	// we cannot use query parameters for the request due to the
+	// possibility of triggering a 414 response (URI Too Long).
+
+	// instead, write the json to the body of the request.
+	// NOTE: Solr is lenient; GET or POST works fine for this.
+
+	// try each replica in turn, failing over to the next one on transport errors, or on
+	// transient failure statuses once retries are exhausted.  the last replica's response
+	// is returned whatever its status.
+
+	var ctx httpClientContext
+	var req *http.Request
+	var res *http.Response
+	var resErr error
+	var elapsedMS int64
+
+	replicas := s.pool.solr.replicasForRequest()
+
+	for i, replica := range replicas {
+		ctx = replica.service
+
+		if i > 0 {
+			s.log("SOLR: failing over to replica %s", replica.host)
 		}
-	} else {
-		decoder := json.NewDecoder(res.Body)
 
-		// external service failure logging (scenario 2)
+		var reqErr error
+		req, reqErr = http.NewRequestWithContext(reqCtx, "POST", ctx.url, bytes.NewBuffer(jsonBytes))
+		if reqErr != nil {
+			s.log("SOLR: NewRequest() failed: %s", reqErr.Error())
+			return solrFetchResult{}, fmt.Errorf("failed to create Solr request")
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		start := time.Now()
+		res, resErr = ctx.do(req, true)
+		elapsedMS = int64(time.Since(start) / time.Millisecond)
+
+		if resErr == nil {
+			if isRetryableStatus(res.StatusCode) == false || i == len(replicas)-1 {
+				break
+			}
+
+			s.log("SOLR: replica %s responded with status %d", replica.host, res.StatusCode)
+			s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, res.StatusCode, http.StatusText(res.StatusCode), elapsedMS)
 
-		if decErr := decoder.Decode(&s.solr.res); decErr != nil {
-			s.log("SOLR: Decode() failed: %s", decErr.Error())
-			s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, http.StatusInternalServerError, decErr.Error(), elapsedMS)
-			return fmt.Errorf("failed to decode Solr response")
+			res.Body.Close()
+			continue
 		}
+
+		// no point failing over if the request itself is done
+		if ctxErr := reqCtx.Err(); ctxErr != nil {
+			s.log("SOLR: request abandoned: %s", ctxErr.Error())
+			return solrFetchResult{}, contextStatusError(ctxErr)
+		}
+
+		// external service failure logging (scenario 1)
+
+		s.log("SOLR: client.Do() failed: %s", resErr.Error())
+		s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, statusFromError(resErr, http.StatusBadGateway), resErr.Error(), elapsedMS)
 	}
 
-	// external service success logging
+	if resErr != nil {
+		return solrFetchResult{}, &httpStatusError{status: statusFromError(resErr, http.StatusBadGateway), err: fmt.Errorf("failed to receive Solr response")}
+	}
 
-	s.log("Successful Solr response from %s %s. Elapsed Time: %d (ms)", req.Method, ctx.url, elapsedMS)
+	defer res.Body.Close()
 
-	s.log("SOLR: endpoint: %-8s  qtime: %5d  elapsed: %5d  overhead: %5d", s.virgo.endpoint, s.solr.res.ResponseHeader.QTime, elapsedMS, elapsedMS-int64(s.solr.res.ResponseHeader.QTime))
+	body, readErr := ioutil.ReadAll(res.Body)
 
+	// external service failure logging (scenario 2)
+
+	if readErr != nil {
+		s.log("SOLR: ReadAll() failed: %s", readErr.Error())
+		s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, http.StatusBadGateway, readErr.Error(), elapsedMS)
+		return solrFetchResult{}, &httpStatusError{status: http.StatusBadGateway, err: fmt.Errorf("failed to read Solr response")}
+	}
+
+	return solrFetchResult{body: body, method: req.Method, url: ctx.url, elapsedMS: elapsedMS}, nil
+}
+
+func (s *searchContext) processSolrResponse() error {
 	s.convertFacets()
 
 	// log abbreviated results
@@ -216,37 +308,29 @@ func (s *searchContext) solrQuery() error {
 	return nil
 }
 
-func (s *searchContext) solrPing() error {
-	ctx := s.pool.solr.healthCheck
+func (s *searchContext) solrPing(r *solrReplica) error {
+	ctx := r.healthCheck
 
 	s.solr.res = solrResponse{}
 
-	req, reqErr := http.NewRequest("GET", ctx.url, nil)
+	req, reqErr := http.NewRequestWithContext(s.ctx, "GET", ctx.url, nil)
 	if reqErr != nil {
 		s.log("SOLR: NewRequest() failed: %s", reqErr.Error())
 		return fmt.Errorf("failed to create Solr request")
 	}
 
 	start := time.Now()
-	res, resErr := ctx.client.Do(req)
+	res, resErr := ctx.do(req, false)
 	elapsedMS := int64(time.Since(start) / time.Millisecond)
 
 	// external service failure logging (scenario 1)
 
 	if resErr != nil {
-		status := http.StatusBadRequest
-		errMsg := resErr.Error()
-		if strings.Contains(errMsg, "Timeout") {
-			status = http.StatusRequestTimeout
-			errMsg = fmt.Sprintf("%s timed out", ctx.url)
-		} else if strings.Contains(errMsg, "connection refused") {
-			status = http.StatusServiceUnavailable
-			errMsg = fmt.Sprintf("%s refused connection", ctx.url)
-		}
+		status := statusFromError(resErr, http.StatusBadGateway)
 
 		s.log("SOLR: client.Do() failed: %s", resErr.Error())
-		s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, status, errMsg, elapsedMS)
-		return fmt.Errorf("failed to receive Solr response")
+		s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, status, resErr.Error(), elapsedMS)
+		return &httpStatusError{status: status, err: fmt.Errorf("failed to receive Solr response")}
 	}
 
 	defer res.Body.Close()
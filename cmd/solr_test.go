@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestReplica(url string) *solrReplica {
+	r := solrReplica{
+		host:       url,
+		service:    httpClientContext{client: http.DefaultClient, url: url, enabled: true, retry: retryPolicy{maxRetries: 1}},
+		inRotation: true,
+	}
+
+	return &r
+}
+
+func TestSolrFetchFailsOverOnRetryableStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int // per replica, in the order they are tried
+		wantBody   string
+		wantCounts []int32
+	}{
+		{
+			name:       "unavailable then healthy",
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantBody:   "replica 1",
+			wantCounts: []int32{2, 1},
+		},
+		{
+			name:       "healthy first",
+			statuses:   []int{http.StatusOK, http.StatusOK},
+			wantBody:   "replica 0",
+			wantCounts: []int32{1, 0},
+		},
+		{
+			name:       "client error is not failed over",
+			statuses:   []int{http.StatusBadRequest, http.StatusOK},
+			wantBody:   "replica 0",
+			wantCounts: []int32{1, 0},
+		},
+		{
+			name:       "all unavailable",
+			statuses:   []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+			wantBody:   "replica 1",
+			wantCounts: []int32{2, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := make([]int32, len(tt.statuses))
+
+			var replicas []*solrReplica
+
+			for i := range tt.statuses {
+				i := i
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&counts[i], 1)
+					w.WriteHeader(tt.statuses[i])
+					fmt.Fprintf(w, "replica %d", i)
+				}))
+				defer srv.Close()
+
+				replicas = append(replicas, newTestReplica(srv.URL))
+			}
+
+			s := searchContext{
+				pool:   &poolContext{solr: poolSolr{replicas: replicas}},
+				client: &clientContext{},
+			}
+
+			// replicas are tried round-robin, starting after the last one used
+			s.pool.solr.nextReplica.Store(uint64(len(replicas) - 1))
+
+			res, err := s.solrFetch(context.Background(), []byte("{}"))
+			if err != nil {
+				t.Fatalf("solrFetch() failed: %s", err.Error())
+			}
+
+			if string(res.body) != tt.wantBody {
+				t.Errorf("got body [%s], want [%s]", res.body, tt.wantBody)
+			}
+
+			for i := range counts {
+				if got := atomic.LoadInt32(&counts[i]); got != tt.wantCounts[i] {
+					t.Errorf("replica %d: got %d requests, want %d", i, got, tt.wantCounts[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/uvalib/virgo4-parser/v4parser"
+)
+
+// "did you mean" suggestions: solr's spellcheck component collates corrections for
+// the words of the query, and those corrections are applied to the field values seen
+// by the v4 parser so that suggestions can be returned in v4 query syntax.  each suggestion
+// is returned as a pool result warning consisting of spellingSuggestionPrefix followed by the
+// corrected v4 query, so that clients can tell suggestions apart from other warnings, and
+// search for the remainder as-is.
+
+const spellingSuggestionPrefix = "Did you mean: "
+
+func (s *searchContext) spellcheckFields() ([]string, bool) {
+	// returns the fields of the parsed query, and whether they can all be spellchecked.
+	// queries with other fields or boolean operators cannot be faithfully rebuilt.
+
+	if s.virgo.parserInfo == nil {
+		return nil, false
+	}
+
+	// AND'd values can be rebuilt as AND'd field queries, but nothing else can
+	for _, op := range s.virgo.parserInfo.booleanOperators {
+		if op != "AND" {
+			return nil, false
+		}
+	}
+
+	var fields []string
+
+	for field := range s.virgo.parserInfo.parser.FieldValues {
+		if sliceContainsString(s.pool.config.Local.Solr.Spellcheck.Fields, field, false) == false {
+			return nil, false
+		}
+
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	return fields, len(fields) > 0
+}
+
+func (s *searchContext) spellcheckValues(field string) []string {
+	// field values as the client entered them
+
+	var values []string
+
+	for _, val := range s.virgo.parserInfo.parser.FieldValues[field] {
+		unescaped, err := unescapeParserValue(val)
+		if err != nil {
+			continue
+		}
+
+		values = append(values, strings.TrimSpace(unescaped))
+	}
+
+	return values
+}
+
+func (s *searchContext) solrRequestSpellcheck() {
+	fields, ok := s.spellcheckFields()
+	if ok == false {
+		return
+	}
+
+	var words []string
+
+	for _, field := range fields {
+		for _, val := range s.spellcheckValues(field) {
+			words = append(words, strings.Fields(strings.ReplaceAll(val, `"`, " "))...)
+		}
+	}
+
+	if len(words) == 0 {
+		return
+	}
+
+	cfg := s.pool.config.Local.Solr.Spellcheck
+
+	s.solr.req.json.Params.Spellcheck = "true"
+	s.solr.req.json.Params.SpellcheckQ = strings.Join(words, " ")
+	s.solr.req.json.Params.SpellcheckDictionary = cfg.Dictionary
+	s.solr.req.json.Params.SpellcheckCount = cfg.Count
+	s.solr.req.json.Params.SpellcheckCollate = "true"
+	s.solr.req.json.Params.SpellcheckMaxCollations = cfg.MaxCollations
+	s.solr.req.json.Params.SpellcheckMaxCollationTries = cfg.MaxCollationTries
+	s.solr.req.json.Params.SpellcheckCollateExtendedResults = "true"
+}
+
+func spellcheckCorrections(collation interface{}) map[string]string {
+	// extended collation results list each misspelling followed by its correction
+
+	details, ok := collation.(map[string]interface{})
+	if ok == false {
+		return nil
+	}
+
+	pairs, ok := details["misspellingsAndCorrections"].([]interface{})
+	if ok == false {
+		return nil
+	}
+
+	corrections := make(map[string]string)
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		misspelling, mok := pairs[i].(string)
+		correction, cok := pairs[i+1].(string)
+
+		if mok == true && cok == true {
+			corrections[strings.ToLower(misspelling)] = correction
+		}
+	}
+
+	return corrections
+}
+
+func (s *searchContext) spellingSuggestions() []string {
+	// returns corrected v4 queries as prefixed warnings, if any
+
+	fields, ok := s.spellcheckFields()
+	if ok == false {
+		return nil
+	}
+
+	var suggestions []string
+
+	seen := make(map[string]bool)
+
+	collations := s.solr.res.Spellcheck.Collations
+
+	for i := 0; i+1 < len(collations); i += 2 {
+		if label, _ := collations[i].(string); label != "collation" {
+			continue
+		}
+
+		corrections := spellcheckCorrections(collations[i+1])
+		if len(corrections) == 0 {
+			continue
+		}
+
+		var clauses []string
+
+		usable := true
+
+		for _, field := range fields {
+			for _, val := range s.spellcheckValues(field) {
+				words := strings.Fields(val)
+
+				for j, word := range words {
+					// keep any phrase quoting around corrected words
+					bare := strings.Trim(word, `"`)
+					if correction, found := corrections[strings.ToLower(bare)]; found == true {
+						words[j] = strings.Replace(word, bare, correction, 1)
+					}
+				}
+
+				corrected := strings.Join(words, " ")
+
+				// braces delimit values in v4 query syntax
+				if strings.ContainsAny(corrected, "{}") == true {
+					usable = false
+				}
+
+				clauses = append(clauses, fmt.Sprintf("%s: {%s}", field, corrected))
+			}
+		}
+
+		if usable == false {
+			continue
+		}
+
+		query := strings.Join(clauses, " AND ")
+
+		if query == s.virgo.req.Query || seen[query] == true {
+			continue
+		}
+
+		// make sure we are suggesting something the client can actually search for
+		if valid, errors := v4parser.Validate(query); valid == false {
+			s.warn("discarding invalid spelling suggestion [%s]: %s", query, errors)
+			continue
+		}
+
+		seen[query] = true
+
+		suggestions = append(suggestions, spellingSuggestionPrefix+query)
+	}
+
+	return suggestions
+}
@@ -1,20 +1,36 @@
 package main
 
-import "log"
-
 type stringValidator struct {
+	pool    *poolContext
+	schema  *solrSchema // if set, values are checked against it as solr field names
 	values  []string
 	invalid bool
 	prefix  string
 	postfix string
+	context interface{} // config value to report problems against, when the value itself is not in the config
 }
 
 func (v *stringValidator) addValue(value string) {
+	v.checkSolrField(&value, "field", solrFieldExists)
+	v.appendValue(value)
+}
+
+func (v *stringValidator) appendValue(value string) {
 	if value != "" {
 		v.values = append(v.values, value)
 	}
 }
 
+func (v *stringValidator) location(value *string) interface{} {
+	// the config value to report a problem with the given value against
+
+	if configPath(v.pool.config, value) == "" {
+		return v.context
+	}
+
+	return value
+}
+
 func (v *stringValidator) setPrefix(prefix string) {
 	v.prefix = prefix
 }
@@ -23,14 +39,19 @@ func (v *stringValidator) setPostfix(postfix string) {
 	v.postfix = postfix
 }
 
-func (v *stringValidator) requireValue(value string, label string) {
-	if value == "" {
-		log.Printf("[VALIDATE] %smissing %s%s", v.prefix, label, v.postfix)
+func (v *stringValidator) setContext(context interface{}) {
+	v.context = context
+}
+
+func (v *stringValidator) requireValue(value *string, label string) {
+	if *value == "" {
+		v.pool.configProblem(v.location(value), "[VALIDATE] %smissing %s%s", v.prefix, label, v.postfix)
 		v.invalid = true
 		return
 	}
 
-	v.addValue(value)
+	v.checkSolrField(value, label, solrFieldExists)
+	v.appendValue(*value)
 }
 
 func (v *stringValidator) Values() []string {
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// type-ahead suggestions, drawn from the indexed terms of a configured solr field
+// (the "dictionary") that begin with the client's input.  a terms facet is used
+// rather than the terms component or a suggester, so that suggestions are limited
+// to records in this pool that the client could actually find.
+
+const suggestFacet = "suggest"
+
+const defaultSuggestionLimit = 10
+
+type suggestion struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type suggestResponse struct {
+	Query       string       `json:"query"`
+	Field       string       `json:"field"`
+	Suggestions []suggestion `json:"suggestions"`
+}
+
+func (s *searchContext) suggestionConfig(field string) *poolConfigSuggestion {
+	for i := range s.resourceTypeCtx.Suggestions {
+		cfg := &s.resourceTypeCtx.Suggestions[i]
+		if cfg.Field == field {
+			return cfg
+		}
+	}
+
+	return nil
+}
+
+func (s *searchContext) solrSuggestRequest(cfg *poolConfigSuggestion, prefix string) {
+	s.solr.req = solrRequest{}
+
+	s.solr.req.meta.client = s.client
+	s.solr.req.meta.selectionMap = make(map[string]map[string]string)
+
+	s.solr.req.json.Params.Q = "*:*"
+	s.solr.req.json.Params.Rows = 0
+
+	// same restrictions as a search, so that suggestions lead to results
+
+	fq := s.pool.config.Local.Solr.Params.Fq.Global
+	fq = append(fq, s.pool.config.Local.Solr.Params.Fq.Visible...)
+	fq = append(fq, s.pool.config.Local.Solr.Params.Fq.Pool...)
+
+	s.solr.req.json.Params.Fq = nonemptyValues(fq)
+
+	limit := cfg.Limit
+	if limit <= 0 {
+		limit = defaultSuggestionLimit
+	}
+
+	// rank suggestions by the number of distinct works they would find
+
+	s.solr.req.json.Facets = map[string]*solrRequestFacet{
+		suggestFacet: {
+			Type:     "terms",
+			Field:    cfg.Dictionary,
+			Prefix:   prefix,
+			Sort:     "group_count desc",
+			Limit:    limit,
+			MinCount: 1,
+			Facet:    solrRequestSubFacet{GroupCount: fmt.Sprintf("unique(%s)", s.pool.config.Local.Solr.GroupField)},
+		},
+	}
+}
+
+func (s *searchContext) handleSuggestRequest() searchResponse {
+	s.virgo.endpoint = "suggest"
+
+	q := strings.TrimSpace(s.client.ginCtx.Query("q"))
+	field := s.client.ginCtx.Query("field")
+
+	if err := validateSolrValue("suggestion query", q); err != nil {
+		return searchResponse{status: http.StatusBadRequest, err: err}
+	}
+
+	// suggestions are configured per resource type; use the default unless told otherwise
+	if resType := s.client.ginCtx.Query("type"); resType != "" {
+		ctx := s.pool.maps.resourceTypeContexts[resType]
+		if ctx == nil {
+			return searchResponse{status: http.StatusBadRequest, err: fmt.Errorf("unrecognized resource type: [%s]", resType)}
+		}
+		s.resourceTypeCtx = ctx
+	}
+
+	cfg := s.suggestionConfig(field)
+	if cfg == nil {
+		return searchResponse{status: http.StatusBadRequest, err: fmt.Errorf("suggestions not supported for field: [%s]", field)}
+	}
+
+	prefix := q
+	if cfg.Lowercase == true {
+		prefix = strings.ToLower(prefix)
+	}
+
+	s.solrSuggestRequest(cfg, prefix)
+
+	if err := s.solrQuery(); err != nil {
+		s.err("suggest execution error: %s", err.Error())
+		return searchResponse{status: statusFromError(err, http.StatusInternalServerError), err: errors.New("failed to retrieve suggestions")}
+	}
+
+	res := suggestResponse{Query: q, Field: field, Suggestions: []suggestion{}}
+
+	for _, bucket := range s.solr.res.Facets[suggestFacet].Buckets {
+		res.Suggestions = append(res.Suggestions, suggestion{Value: bucket.Val, Count: bucket.GroupCount})
+	}
+
+	return searchResponse{status: http.StatusOK, data: res}
+}
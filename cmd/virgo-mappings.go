@@ -378,6 +378,25 @@ func (s *searchContext) newFacetFromDefinition(facetDef *poolConfigFilter) v4api
 	return facet
 }
 
+func (s *searchContext) newFacetBucket(facetID string, internalValue string, value string, count int) v4api.FacetBucket {
+	// selected values are marked as such; excluded values are also marked
+	// as selected, but are returned with the exclusion prefix the client sent.
+	// values are returned as clients would send them (see markedFilterValue())
+
+	bucket := v4api.FacetBucket{Value: markedFilterValue(value, false), Count: count}
+
+	switch {
+	case s.solr.req.meta.selectionMap[facetID][internalValue] != "":
+		bucket.Selected = true
+
+	case s.solr.req.meta.exclusionMap[facetID][internalValue] != "":
+		bucket.Value = markedFilterValue(value, true)
+		bucket.Selected = true
+	}
+
+	return bucket
+}
+
 func (s *searchContext) populateFacet(facetDef *poolConfigFilter, value solrResponseFacet) v4api.Facet {
 
 	facet := s.newFacetFromDefinition(facetDef)
@@ -393,17 +412,47 @@ func (s *searchContext) populateFacet(facetDef *poolConfigFilter, value solrResp
 
 		buckets = append(buckets, v4api.FacetBucket{Selected: selected})
 
+	case "hierarchy":
+		// child buckets follow their parent bucket
+		for _, b := range value.Buckets {
+			parent := s.getExternalSolrValue(facetDef.Hierarchy.ParentField, b.Val)
+
+			buckets = append(buckets, s.newFacetBucket(facetDef.ID, b.Val, parent, b.Count))
+
+			if b.Children == nil {
+				continue
+			}
+
+			for _, c := range b.Children.Buckets {
+				child := s.getExternalSolrValue(facetDef.Solr.Field, c.Val)
+
+				buckets = append(buckets, s.newFacetBucket(facetDef.ID, facetDef.hierarchyValue(b.Val, c.Val), facetDef.hierarchyValue(parent, child), c.Count))
+			}
+		}
+
+	case "range":
+		// bucket values are canonical range values, so they can be selected as-is.
+		// fixed-size buckets are identified by solr by their starting value only.
+		for _, b := range value.Buckets {
+			rangeValue := b.Val
+			if len(facetDef.ComponentQueries) == 0 {
+				rangeValue = facetDef.Range.bucketValue(b.Val)
+			}
+
+			if rangeValue == "" {
+				continue
+			}
+
+			buckets = append(buckets, s.newFacetBucket(facetDef.ID, rangeValue, rangeValue, b.Count))
+		}
+
 	default:
 		for _, b := range value.Buckets {
 			if len(facetDef.ExposedValues) == 0 || sliceContainsString(facetDef.ExposedValues, b.Val, false) {
 
 				mappedValue := s.getExternalSolrValue(facetDef.Solr.Field, b.Val)
-				selected := false
-				if s.solr.req.meta.selectionMap[facetDef.ID][b.Val] != "" {
-					selected = true
-				}
 
-				buckets = append(buckets, v4api.FacetBucket{Value: mappedValue, Count: b.Count, Selected: selected})
+				buckets = append(buckets, s.newFacetBucket(facetDef.ID, b.Val, mappedValue, b.Count))
 			}
 		}
 
@@ -442,14 +491,14 @@ func (s *searchContext) populateFacet(facetDef *poolConfigFilter, value solrResp
 	return facet
 }
 
-func (s *searchContext) populateFacetList(solrFacets map[string]solrResponseFacet) []v4api.Facet {
+func (s *searchContext) populateFacetList(solrFacets map[string]solrResponseFacet, requestFacets map[string]*solrRequestFacet) []v4api.Facet {
 	type indexedFacet struct {
 		index int
 		facet v4api.Facet
 	}
 
-	// first, convert component query facets back to internal facets by
-	// creating buckets for each component with the translated value
+	// first, convert component query facets (including range histograms) back to
+	// internal facets by creating buckets for each component with the translated value
 
 	mergedFacets := make(map[string]solrResponseFacet)
 	componentQueries := make(map[string]map[string]*solrResponseFacet)
@@ -458,13 +507,13 @@ func (s *searchContext) populateFacetList(solrFacets map[string]solrResponseFace
 	for key := range solrFacets {
 		val := solrFacets[key]
 
-		if s.solr.req.meta.requestFacets[key] == nil {
+		if requestFacets[key] == nil {
 			continue
 		}
 
-		switch s.solr.req.meta.requestFacets[key].config.Type {
-		case "component":
-			xid := s.solr.req.meta.requestFacets[key].config.ID
+		switch {
+		case len(requestFacets[key].config.ComponentQueries) > 0:
+			xid := requestFacets[key].config.ID
 			if componentQueries[xid] == nil {
 				componentQueries[xid] = make(map[string]*solrResponseFacet)
 			}
@@ -513,6 +562,10 @@ func (s *searchContext) populateFacetList(solrFacets map[string]solrResponseFace
 				}
 			} else {
 				facetDef = s.resourceTypeCtx.filterMap[key]
+
+				if s.resourceTypeCtx.returnsFacet(key) == false {
+					continue
+				}
 			}
 
 			// if this is not the facet cache requesting all facets, then
@@ -561,6 +614,21 @@ func (s *searchContext) populateFacetList(solrFacets map[string]solrResponseFace
 	return facetList
 }
 
+func (s *searchContext) populateSelectedFacetList() []v4api.Facet {
+	// facets requested with all filters applied are returned under prefixed keys;
+	// strip the prefix and convert them as usual
+
+	solrFacets := make(map[string]solrResponseFacet)
+
+	for key, val := range s.solr.res.Facets {
+		if strings.HasPrefix(key, selectedFacetPrefix) == true {
+			solrFacets[strings.TrimPrefix(key, selectedFacetPrefix)] = val
+		}
+	}
+
+	return s.populateFacetList(solrFacets, s.solr.req.meta.selectedFacets)
+}
+
 func (s *searchContext) itemIsExactMatch(doc *solrDocument) bool {
 	// encapsulates document-level exact-match logic for a given search
 
@@ -655,14 +723,21 @@ func (s *searchContext) buildPoolSearchResponse() searchResponse {
 		}
 	}
 
-	pr.FacetList = s.populateFacetList(s.solr.res.Facets)
+	pr.FacetList = s.populateFacetList(s.solr.res.Facets, s.solr.req.meta.requestFacets)
 
 	pr.Warnings = s.solr.res.meta.warnings
 
+	// spelling suggestions follow any other warnings, best first
+	if s.virgo.flags.spellcheck == true && s.solr.res.meta.totalRows <= s.pool.config.Local.Solr.Spellcheck.MaxResults {
+		pr.Warnings = append(pr.Warnings, s.spellingSuggestions()...)
+	}
+
 	if s.client.opts.debug == true {
 		pr.Debug = make(map[string]interface{})
 		pr.Debug["request_id"] = s.client.reqID
 		pr.Debug["max_score"] = s.solr.res.meta.maxScore
+		pr.Debug["solr_cache_hit"] = s.solr.res.meta.cacheHit
+		pr.Debug["solr_cache"] = s.pool.solr.cache.stats()
 		//pr.Debug["solr"] = s.solr.res.Debug
 	}
 
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"strings"
+
+	"github.com/antlr4-go/antlr/v4"
 	"github.com/uvalib/virgo4-parser/v4parser"
 )
 
@@ -27,5 +30,25 @@ func (s *searchContext) virgoQueryConvertToSolr(virgoQuery string) (*solrParserI
 	sp.isSingleIdentifierSearch = total == 1 && len(sp.identifiers) == 1
 	sp.isFulltextSearch = len(sp.fulltexts) > 0
 
+	sp.booleanOperators = virgoQueryBooleanOperators(virgoQuery)
+
 	return &sp, nil
 }
+
+func virgoQueryBooleanOperators(virgoQuery string) []string {
+	// returns the boolean operators in a valid query, as the parser sees them
+	// (i.e. not words within values, such as in quoted phrases)
+
+	var ops []string
+
+	lexer := v4parser.NewVirgoQueryLexer(antlr.NewInputStream(virgoQuery))
+	lexer.RemoveErrorListeners()
+
+	for tok := lexer.NextToken(); tok.GetTokenType() != antlr.TokenEOF; tok = lexer.NextToken() {
+		if tok.GetTokenType() == v4parser.VirgoQueryLexerBOOLEAN {
+			ops = append(ops, strings.ToUpper(tok.GetText()))
+		}
+	}
+
+	return ops
+}
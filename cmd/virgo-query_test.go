@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVirgoQueryBooleanOperators(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "single field", query: `title: {war and peace}`, want: ""},
+		{name: "quoted operator", query: `title: {"war OR peace"}`, want: ""},
+		{name: "lowercase operator", query: `title: {war or peace}`, want: ""},
+		{name: "between values", query: `keyword: {war AND peace}`, want: "AND"},
+		{name: "negated value", query: `title: {war NOT peace}`, want: "NOT"},
+		{name: "between fields", query: `title: {war} OR author: {tolstoy} AND subject: {russia}`, want: "OR AND"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(virgoQueryBooleanOperators(tt.query), " "); got != tt.want {
+				t.Errorf("got [%s], want [%s]", got, tt.want)
+			}
+		})
+	}
+}
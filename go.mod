@@ -3,6 +3,7 @@ module github.com/uvalib/virgo4-pool-solr-ws
 go 1.25.0
 
 require (
+	github.com/antlr4-go/antlr/v4 v4.13.1
 	github.com/gin-contrib/cors v1.7.7
 	github.com/gin-contrib/gzip v1.2.6
 	github.com/gin-contrib/pprof v1.5.4
@@ -15,7 +16,6 @@ require (
 )
 
 require (
-	github.com/antlr4-go/antlr/v4 v4.13.1 // indirect
 	github.com/bytedance/gopkg v0.1.4 // indirect
 	github.com/bytedance/sonic v1.15.2 // indirect
 	github.com/bytedance/sonic/loader v0.5.1 // indirect